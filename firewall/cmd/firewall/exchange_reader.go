@@ -0,0 +1,155 @@
+// File to read recorded HTTP exchanges replayed by the test command
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exchange is a single recorded request/response pair.
+// Expect is optional: "allow" or "forbid".
+type Exchange struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+	Expect   string           `json:"expect,omitempty"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type RecordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type ExchangeReader interface {
+	ReadExchanges() ([]*Exchange, error)
+}
+
+type ExchangeFileReader struct {
+	src string
+}
+
+func NewExchangeFileReader(src string) *ExchangeFileReader {
+	return &ExchangeFileReader{src}
+}
+
+// ReadExchanges reads a HAR file when src has the .har extension
+// and a file with one JSON encoded Exchange per line otherwise.
+func (r *ExchangeFileReader) ReadExchanges() ([]*Exchange, error) {
+	f, err := os.Open(r.src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(r.src), ".har") {
+		return readHAR(f)
+	}
+	return readJSONLines(f)
+}
+
+func readJSONLines(r io.Reader) ([]*Exchange, error) {
+	var exchanges []*Exchange
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var e Exchange
+		if err := json.Unmarshal(text, &e); err != nil {
+			return nil, fmt.Errorf("line %d: exchange parsing errored: %w", line, err)
+		}
+		exchanges = append(exchanges, &e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file reading failed: %w", err)
+	}
+	return exchanges, nil
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method   string      `json:"method"`
+				URL      string      `json:"url"`
+				Headers  []harHeader `json:"headers"`
+				PostData struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int         `json:"status"`
+				Headers []harHeader `json:"headers"`
+				Content struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+func readHAR(r io.Reader) ([]*Exchange, error) {
+	var har harLog
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("har parsing errored: %w", err)
+	}
+
+	exchanges := make([]*Exchange, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		exchanges = append(exchanges, &Exchange{
+			Request: RecordedRequest{
+				Method:  entry.Request.Method,
+				URL:     entry.Request.URL,
+				Headers: harHeaders(entry.Request.Headers),
+				Body:    entry.Request.PostData.Text,
+			},
+			Response: RecordedResponse{
+				Status:  entry.Response.Status,
+				Headers: harHeaders(entry.Response.Headers),
+				Body:    entry.Response.Content.Text,
+			},
+		})
+	}
+	return exchanges, nil
+}
+
+func harHeaders(headers []harHeader) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		// skip HTTP/2 pseudo-headers like :authority
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		name := http.CanonicalHeaderKey(h.Name)
+		if v, ok := m[name]; ok {
+			m[name] = v + ", " + h.Value
+			continue
+		}
+		m[name] = h.Value
+	}
+	return m
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -98,6 +99,10 @@ func parseFlags(path, saddr, addr *string) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runTest(os.Args[2:], os.Stdout))
+	}
+
 	var confPath, saddr, addr string
 	parseFlags(&confPath, &saddr, &addr)
 
@@ -0,0 +1,197 @@
+// File to replay recorded exchanges against the rules without a proxy or upstream
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExpectAllow  = "allow"
+	ExpectForbid = "forbid"
+)
+
+type CheckResult struct {
+	Name   string
+	Passed bool
+}
+
+type ExchangeReport struct {
+	Exchange       *Exchange
+	Rule           *Rule
+	RequestChecks  []CheckResult
+	ResponseChecks []CheckResult
+}
+
+// Allowed reports whether the firewall would pass the exchange through.
+func (rep *ExchangeReport) Allowed() bool {
+	for _, c := range rep.RequestChecks {
+		if !c.Passed {
+			return false
+		}
+	}
+	for _, c := range rep.ResponseChecks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Unexpected reports whether the verdict contradicts the recorded expectation.
+func (rep *ExchangeReport) Unexpected() bool {
+	switch rep.Exchange.Expect {
+	case ExpectAllow:
+		return !rep.Allowed()
+	case ExpectForbid:
+		return rep.Allowed()
+	default:
+		return false
+	}
+}
+
+// Replay runs every request and response check of the matching rule.
+// Unlike the proxy it does not stop at the first failed check.
+func (ru *RulesExecutorYaml) Replay(e *Exchange) (*ExchangeReport, error) {
+	r, err := newRecordedRequest(e.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &ExchangeReport{
+		Exchange: e,
+		Rule:     ru.getRule(r),
+	}
+	if rep.Rule == nil {
+		return rep, nil
+	}
+
+	for _, c := range requestChecks {
+		rep.RequestChecks = append(rep.RequestChecks, CheckResult{c.name, c.check(rep.Rule, r)})
+	}
+
+	w := newRecordedResponse(e.Response)
+	for _, c := range responseChecks {
+		rep.ResponseChecks = append(rep.ResponseChecks, CheckResult{c.name, c.check(rep.Rule, w)})
+	}
+
+	return rep, nil
+}
+
+func newRecordedRequest(rr RecordedRequest) (*http.Request, error) {
+	r, err := http.NewRequest(rr.Method, rr.URL, strings.NewReader(rr.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded request: %w", err)
+	}
+	for k, v := range rr.Headers {
+		r.Header.Set(k, v)
+	}
+	return r, nil
+}
+
+func newRecordedResponse(rr RecordedResponse) ResponseExecutor {
+	w := newResponseExecutor(httptest.NewRecorder())
+	for k, v := range rr.Headers {
+		w.Header().Set(k, v)
+	}
+	// the upstream sends Content-Length for non-streamed bodies,
+	// recordings often drop it
+	if w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(rr.Body)))
+	}
+
+	status := rr.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(rr.Body))
+	return w
+}
+
+func writeReport(out io.Writer, n int, rep *ExchangeReport) {
+	req := rep.Exchange.Request
+	fmt.Fprintf(out, "#%d %s %s\n", n, req.Method, req.URL)
+
+	if rep.Rule == nil {
+		fmt.Fprintf(out, "  rule: none\n")
+	} else {
+		fmt.Fprintf(out, "  rule: %q\n", rep.Rule.Endpoint)
+		writeChecks(out, "request", rep.RequestChecks)
+		writeChecks(out, "response", rep.ResponseChecks)
+	}
+
+	verdict := ExpectAllow
+	if !rep.Allowed() {
+		verdict = ExpectForbid
+	}
+	if rep.Exchange.Expect != "" {
+		fmt.Fprintf(out, "  verdict: %s (expected %s)\n", verdict, rep.Exchange.Expect)
+	} else {
+		fmt.Fprintf(out, "  verdict: %s\n", verdict)
+	}
+}
+
+func writeChecks(out io.Writer, title string, checks []CheckResult) {
+	fmt.Fprintf(out, "  %s:\n", title)
+	for _, c := range checks {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(out, "    %-26s %s\n", c.Name, status)
+	}
+}
+
+// runTest implements `firewall test -conf rules.yaml -exchanges traffic.jsonl`.
+// It returns 1 if some exchange contradicts its expectation and 2 on invalid input.
+func runTest(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(out)
+	confPath := fs.String("conf", "configs/example.yaml", "config with rules")
+	exchangesPath := fs.String("exchanges", "", "recorded exchanges (.har or JSON lines)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *exchangesPath == "" {
+		fmt.Fprintln(out, "-exchanges is required")
+		return 2
+	}
+
+	rules := NewRulesYaml(NewYAMLFileReader(*confPath))
+	if err := rules.ParseRules(); err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	rules.CompileRules()
+
+	exchanges, err := NewExchangeFileReader(*exchangesPath).ReadExchanges()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+
+	unexpected := 0
+	for i, e := range exchanges {
+		rep, err := rules.Replay(e)
+		if err != nil {
+			fmt.Fprintf(out, "#%d %v\n", i+1, err)
+			return 2
+		}
+		writeReport(out, i+1, rep)
+		if rep.Unexpected() {
+			unexpected++
+		}
+	}
+
+	fmt.Fprintf(out, "%d exchanges, %d unexpected\n", len(exchanges), unexpected)
+	if unexpected > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const replayConf = `
+rules:
+  - endpoint: "/list"
+    forbidden_user_agents:
+      - 'python-requests.*'
+    max_response_length_bytes: 4
+  - endpoint: "/login"
+    forbidden_response_codes: [200]
+`
+
+const replayExchanges = `
+{"request": {"method": "POST", "url": "http://localhost/list", "body": "hi"}, "response": {"status": 200, "body": "hi"}, "expect": "allow"}
+{"request": {"method": "POST", "url": "http://localhost/list", "headers": {"User-Agent": "python-requests/2.22.0"}}, "response": {"status": 200}, "expect": "forbid"}
+{"request": {"method": "GET", "url": "http://localhost/list"}, "response": {"status": 200, "body": "hello"}}
+{"request": {"method": "GET", "url": "http://localhost/other"}, "response": {"status": 200}, "expect": "allow"}
+`
+
+const replayHAR = `{"log": {"entries": [
+  {
+    "request": {"method": "POST", "url": "http://localhost/login", "headers": [{"name": ":authority", "value": "localhost"}]},
+    "response": {"status": 200, "headers": [{"name": "content-type", "value": "text/plain"}], "content": {"text": "ok"}}
+  }
+]}}`
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0666))
+	return path
+}
+
+func replayRules(t *testing.T) *RulesExecutorYaml {
+	t.Helper()
+
+	rules := NewRulesYaml(NewYAMLFileReader(writeTempFile(t, "rules.yaml", replayConf)))
+	require.NoError(t, rules.ParseRules())
+	rules.CompileRules()
+	return rules
+}
+
+func failedChecks(checks []CheckResult) []string {
+	var failed []string
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c.Name)
+		}
+	}
+	return failed
+}
+
+func TestReplay_JSONLines(t *testing.T) {
+	rules := replayRules(t)
+
+	exchanges, err := NewExchangeFileReader(writeTempFile(t, "traffic.jsonl", replayExchanges)).ReadExchanges()
+	require.NoError(t, err)
+	require.Len(t, exchanges, 4)
+
+	for _, tc := range []struct {
+		endpoint       string
+		allowed        bool
+		failedRequest  []string
+		failedResponse []string
+	}{
+		{endpoint: "/list", allowed: true},
+		{endpoint: "/list", allowed: false, failedRequest: []string{"forbidden_user_agents"}},
+		{endpoint: "/list", allowed: false, failedResponse: []string{"max_response_length_bytes"}},
+		{allowed: true},
+	} {
+		rep, err := rules.Replay(exchanges[0])
+		require.NoError(t, err)
+		exchanges = exchanges[1:]
+
+		if tc.endpoint == "" {
+			require.Nil(t, rep.Rule)
+		} else {
+			require.Equal(t, tc.endpoint, rep.Rule.Endpoint)
+			require.Len(t, rep.RequestChecks, len(requestChecks))
+			require.Len(t, rep.ResponseChecks, len(responseChecks))
+		}
+		require.Equal(t, tc.allowed, rep.Allowed())
+		require.Equal(t, tc.failedRequest, failedChecks(rep.RequestChecks))
+		require.Equal(t, tc.failedResponse, failedChecks(rep.ResponseChecks))
+		require.False(t, rep.Unexpected())
+	}
+}
+
+func TestReplay_HAR(t *testing.T) {
+	rules := replayRules(t)
+
+	exchanges, err := NewExchangeFileReader(writeTempFile(t, "traffic.har", replayHAR)).ReadExchanges()
+	require.NoError(t, err)
+	require.Len(t, exchanges, 1)
+	require.Equal(t, map[string]string{"Content-Type": "text/plain"}, exchanges[0].Response.Headers)
+
+	rep, err := rules.Replay(exchanges[0])
+	require.NoError(t, err)
+	require.Equal(t, "/login", rep.Rule.Endpoint)
+	require.False(t, rep.Allowed())
+	require.Equal(t, []string{"forbidden_response_codes"}, failedChecks(rep.ResponseChecks))
+}
+
+func TestRunTest(t *testing.T) {
+	conf := writeTempFile(t, "rules.yaml", replayConf)
+	traffic := writeTempFile(t, "traffic.jsonl", replayExchanges)
+
+	var out bytes.Buffer
+	require.Equal(t, 0, runTest([]string{"-conf", conf, "-exchanges", traffic}, &out))
+	require.Contains(t, out.String(), "4 exchanges, 0 unexpected")
+
+	broken := writeTempFile(t, "broken.jsonl",
+		`{"request": {"method": "GET", "url": "http://localhost/login"}, "response": {"status": 200}, "expect": "allow"}`)
+
+	out.Reset()
+	require.Equal(t, 1, runTest([]string{"-conf", conf, "-exchanges", broken}, &out))
+	require.Contains(t, out.String(), "verdict: forbid (expected allow)")
+
+	out.Reset()
+	require.Equal(t, 2, runTest([]string{"-conf", conf}, &out))
+}
@@ -155,29 +155,42 @@ func (rl *Rule) checkResponseForbiddenCodes(w ResponseExecutor) bool {
 	return true
 }
 
-func (rl *Rule) CheckRequest(r *http.Request) bool {
-	if rl == nil {
-		return true
-	}
+type requestCheck struct {
+	name  string
+	check func(*Rule, *http.Request) bool
+}
 
-	if ok := rl.checkUserAgent(r); !ok {
-		return false
-	}
+type responseCheck struct {
+	name  string
+	check func(*Rule, ResponseExecutor) bool
+}
 
-	if ok := rl.checkRequestForbiddenHeaders(r); !ok {
-		return false
-	}
+// checks are named after the yaml keys they enforce and run in order
+var requestChecks = []requestCheck{
+	{"forbidden_user_agents", (*Rule).checkUserAgent},
+	{"forbidden_headers", (*Rule).checkRequestForbiddenHeaders},
+	{"required_headers", (*Rule).checkRequestRequiredHeaders},
+	{"max_request_length_bytes", (*Rule).checkReqContentLength},
+	{"forbidden_request_re", (*Rule).checkReqBodyContent},
+}
 
-	if ok := rl.checkRequestRequiredHeaders(r); !ok {
-		return false
-	}
+var responseChecks = []responseCheck{
+	{"forbidden_headers", (*Rule).checkResponseForbiddenHeaders},
+	{"required_headers", (*Rule).checkResponseRequiredHeaders},
+	{"max_response_length_bytes", (*Rule).checkRespContentLength},
+	{"forbidden_response_re", (*Rule).checkRespBodyContent},
+	{"forbidden_response_codes", (*Rule).checkResponseForbiddenCodes},
+}
 
-	if ok := rl.checkReqContentLength(r); !ok {
-		return false
+func (rl *Rule) CheckRequest(r *http.Request) bool {
+	if rl == nil {
+		return true
 	}
 
-	if ok := rl.checkReqBodyContent(r); !ok {
-		return false
+	for _, c := range requestChecks {
+		if ok := c.check(rl, r); !ok {
+			return false
+		}
 	}
 
 	return true
@@ -188,24 +201,10 @@ func (rl *Rule) CheckResponse(w ResponseExecutor) bool {
 		return true
 	}
 
-	if ok := rl.checkResponseForbiddenHeaders(w); !ok {
-		return false
-	}
-
-	if ok := rl.checkResponseRequiredHeaders(w); !ok {
-		return false
-	}
-
-	if ok := rl.checkRespContentLength(w); !ok {
-		return false
-	}
-
-	if ok := rl.checkRespBodyContent(w); !ok {
-		return false
-	}
-
-	if ok := rl.checkResponseForbiddenCodes(w); !ok {
-		return false
+	for _, c := range responseChecks {
+		if ok := c.check(rl, w); !ok {
+			return false
+		}
 	}
 
 	return true
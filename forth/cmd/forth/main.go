@@ -0,0 +1,170 @@
+//go:build !change
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitlab.com/slon/shad-go/forth"
+)
+
+const (
+	exitCommand    = "bye"
+	historyCommand = "history"
+	saveCommand    = "save"
+	loadCommand    = "load"
+	runCommand     = "run"
+)
+
+func main() {
+	if len(os.Args) == 3 && os.Args[1] == runCommand {
+		if err := runFile(os.Args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	repl()
+}
+
+// runFile executes a script, errors are prefixed with path:line:column.
+func runFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	e := forth.NewEvaluator()
+	if err := e.Run(context.Background(), f); err != nil {
+		var posErr *forth.PositionError
+		if errors.As(err, &posErr) {
+			return fmt.Errorf("%s:%w", path, err)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// lineWriter remembers whether the output stopped in the middle of a line.
+type lineWriter struct {
+	w       io.Writer
+	midLine bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.midLine = p[len(p)-1] != '\n'
+	}
+	return w.w.Write(p)
+}
+
+func repl() {
+	out := &lineWriter{w: os.Stdout}
+	e := forth.NewEvaluator(forth.WithOutput(out))
+
+	fmt.Printf("Welcome to Forth evaluator! To exit type %q.\n", exitCommand)
+	fmt.Printf("Type %q to list previous lines, \"!n\" to repeat line n and \"!!\" to repeat the last one.\n", historyCommand)
+	fmt.Printf("Type \"%s file\" and \"%s file\" to save the session and restore it.\n", saveCommand, loadCommand)
+
+	var history []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if e.Compiling() {
+			fmt.Print("...")
+		} else {
+			fmt.Print(">")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		text := scanner.Text()
+		if text == exitCommand {
+			break
+		}
+		if text == historyCommand {
+			for i, line := range history {
+				fmt.Printf("%4d  %s\n", i+1, line)
+			}
+			continue
+		}
+		if command, path, ok := strings.Cut(text, " "); ok && (command == saveCommand || command == loadCommand) {
+			if err := snapshotFile(e, command, strings.TrimSpace(path)); err != nil {
+				fmt.Printf("Snapshot error: %s\n", err)
+			}
+			continue
+		}
+		if line, ok := historyLine(history, text); ok {
+			fmt.Println(line)
+			text = line
+		}
+		history = append(history, text)
+
+		stack, err := e.Process(text)
+		if out.midLine {
+			fmt.Println()
+			out.midLine = false
+		}
+		if err != nil {
+			fmt.Printf("Evaluation error: %s\n", err)
+		}
+
+		if !e.Compiling() {
+			printStack(stack)
+		}
+	}
+}
+
+// snapshotFile saves the state of e to path or loads it from there.
+func snapshotFile(e *forth.Evaluator, command, path string) error {
+	if command == loadCommand {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return e.Load(bufio.NewReader(f))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.Save(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// historyLine resolves "!!" and "!n" references to previous lines.
+func historyLine(history []string, text string) (string, bool) {
+	if !strings.HasPrefix(text, "!") || len(history) == 0 {
+		return "", false
+	}
+	if text == "!!" {
+		return history[len(history)-1], true
+	}
+	n, err := strconv.Atoi(text[1:])
+	if err != nil || n < 1 || n > len(history) {
+		return "", false
+	}
+	return history[n-1], true
+}
+
+func printStack(stack []int) {
+	s := make([]string, 0, len(stack))
+	for _, n := range stack {
+		s = append(s, strconv.Itoa(n))
+	}
+	fmt.Printf("Stack: %s\n", strings.Join(s, ", "))
+}
@@ -1,9 +1,17 @@
 //go:build !solution
 
-package main
+package forth
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -13,239 +21,1317 @@ var (
 	ErrNotEnoughElements         = errors.New("not enough elements in stack")
 	ErrInvalidFunctionDefinition = errors.New("invalid function definition")
 	ErrDivideByZero              = errors.New("integer divide by zero")
+	ErrInvalidControlStructure   = errors.New("invalid control structure")
+	ErrInvalidDefinitionName     = errors.New("invalid definition name")
+	ErrInvalidAddress            = errors.New("invalid memory address")
+	ErrOutOfMemory               = errors.New("out of memory")
+	ErrUnterminatedString        = errors.New("unterminated string")
+	ErrReturnStackEmpty          = errors.New("return stack is empty")
+	ErrReturnStackOverflow       = errors.New("return stack overflow")
+	ErrStackOverflow             = errors.New("stack overflow")
+	ErrStepLimitExceeded         = errors.New("step limit exceeded")
+	ErrIntegerOverflow           = errors.New("integer overflow")
+	ErrFloatStackEmpty           = errors.New("float stack is empty")
+	ErrInvalidSnapshot           = errors.New("invalid snapshot")
 	ErrUnprocessableEntity       = func(token string) error { return errors.New("unprocessable entity: " + token) }
 	ErrUnknownToken              = func(token string) error { return errors.New("unknown toke: " + token) }
+	ErrCompileOnlyWord           = func(token string) error { return errors.New("compile only word: " + token) }
+	ErrInterpretOnlyWord         = func(token string) error { return errors.New("interpret only word: " + token) }
+	ErrBuiltinWord               = func(token string) error { return errors.New("builtin word: " + token) }
 )
 
+// PositionError reports the word of the input at which processing failed.
+type PositionError struct {
+	Line, Column int
+	Err          error
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	forthTrue  = -1
+	forthFalse = 0
+)
+
+func boolToInt(b bool) int {
+	if b {
+		return forthTrue
+	}
+	return forthFalse
+}
+
 func isNumeric(s string) bool {
 	_, err := strconv.Atoi(s)
 	return err == nil
 }
 
-type stack []int
+// opcode values are stored in snapshots,
+// snapshotVersion has to be bumped when they change.
+type opcode int
+
+const (
+	opNop opcode = iota
+
+	// primitives, each one is a whole builtin word
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opEq
+	opLt
+	opGt
+	opAnd
+	opOr
+	opInvert
+	opDup
+	opOver
+	opDrop
+	opSwap
+	opStore
+	opFetch
+	opAddStore
+	opAllot
+	opHere
+	opCells
+	opDot
+	opEmit
+	opCr
+	opPrintStack
+	opWords
+	opToR
+	opFromR
+	opRFetch
+	opExit
+
+	// arithmetic of IntChecked and IntBig modes
+	opAddChecked
+	opSubChecked
+	opMulChecked
+	opDivChecked
+	opAddStoreChecked
+	opBigAdd
+	opBigSub
+	opBigMul
+	opBigDiv
+	opBigAnd
+	opBigOr
+	opBigInvert
+	opBigEq
+	opBigLt
+	opBigGt
+	opBigAddStore
 
-func (s *stack) Push(v int) {
-	*s = append(*s, v)
+	// float stack words
+	opFAdd
+	opFSub
+	opFMul
+	opFDiv
+	opFDot
+	opFDup
+	opFDrop
+	opFSwap
+	opIntToFloat
+	opFloatToInt
+
+	opDo // move limit and index to the return stack
+
+	// followed by a single operand
+	opPush       // push operand
+	opCall       // run word with index operand
+	opJump       // continue at operand
+	opJumpIfZero // pop flag, continue at operand if it is zero
+	opLoop       // increment index, continue at operand while it is below limit
+	opLoopIndex  // push index of the loop operand levels out
+	opPrint      // print string with index operand
+	opHost       // run host function with index operand
+	opFPush      // push float with bits operand to the float stack
+	opMarker     // forget the word with index operand once the running word returns
+
+	opCount // number of opcodes, not an instruction
+)
+
+// maxCallDepth and maxReturnStack bound nesting of user word calls
+// and the number of cells kept on the return stack.
+const (
+	maxCallDepth   = 1 << 14
+	maxReturnStack = 1 << 16
+)
+
+// maxInlineSize bounds the code copied into a caller instead of a call.
+const maxInlineSize = 16
+
+func (op opcode) hasOperand() bool {
+	return op >= opPush
 }
 
-func (s stack) Top() (int, error) {
-	if len(s) == 0 {
-		return 0, ErrStackEmpty
+func (op opcode) isJump() bool {
+	return op == opJump || op == opJumpIfZero || op == opLoop
+}
+
+// usesFrame reports whether op depends on the frame of the running word.
+func (op opcode) usesFrame() bool {
+	return op == opToR || op == opFromR || op == opRFetch || op == opExit || op == opDo
+}
+
+var primitives = map[string]opcode{
+	"+":      opAdd,
+	"-":      opSub,
+	"*":      opMul,
+	"/":      opDiv,
+	"=":      opEq,
+	"<":      opLt,
+	">":      opGt,
+	"and":    opAnd,
+	"or":     opOr,
+	"invert": opInvert,
+	"dup":    opDup,
+	"over":   opOver,
+	"drop":   opDrop,
+	"swap":   opSwap,
+	"!":      opStore,
+	"@":      opFetch,
+	"+!":     opAddStore,
+	"allot":  opAllot,
+	"here":   opHere,
+	"cells":  opCells,
+	".":      opDot,
+	"emit":   opEmit,
+	"cr":     opCr,
+	".s":     opPrintStack,
+	"words":  opWords,
+}
+
+// word is a compiled definition.
+// code is a flat sequence of opcodes, some of them followed by an operand.
+type word struct {
+	name string
+	code []int
+	// shadows is the index the name referred to before the word was defined,
+	// -1 if it was unknown
+	shadows int
+	// mark is the state to roll back to when the word is forgotten
+	mark mark
+}
+
+// mark is the size of the parts of the evaluator state that grow with definitions.
+type mark struct {
+	memory  int
+	strings int
+	hosts   int
+}
+
+// host is a function registered with Define.
+type host struct {
+	name string
+	fn   func(*Stack) error
+}
+
+// callFrame is where a called word returns to. rbase is the height
+// of the return stack at the call, returning drops everything above it.
+type callFrame struct {
+	code  []int
+	pc    int
+	rbase int
+}
+
+// controlState is the state of exec that is not touched by primitives.
+// It lives behind a pointer to keep the hot locals of exec in registers,
+// its buffers are reused between runs.
+type controlState struct {
+	calls []callFrame
+	// cells is the return stack, base is where the running word's part starts
+	cells []int
+	base  int
+	// budget is the number of steps left until the next checkpoint
+	budget int
+}
+
+type Evaluator struct {
+	// words holds every definition ever compiled. Redefinition appends a new
+	// word, so code compiled earlier keeps calling the old one by index.
+	words      []*word
+	dictionary map[string]int
+	// Stack holds cells, in IntBig mode the values that do not fit
+	// are references and BigStack returns the actual values
+	Stack      Stack
+	FloatStack []float64
+	// fence is the number of builtin words, they can not be forgotten
+	fence int
+	// rollback is the index of the word the earliest marker run by the current word
+	// forgets, markers are never builtin so zero means none
+	rollback  int
+	hosts     []host
+	hostStack Stack
+	// memory is addressed by cell index, HERE is its length
+	memory []int
+	// strings holds the text of compiled ." literals
+	strings []string
+	// pending holds definitions being compiled, they may span several lines
+	pending []*definition
+	input   scanner
+	line    int
+	control controlState
+	Output  io.Writer
+
+	limits limits
+	ints   IntMode
+	floats bool
+	bigs   bigValues
+	ctx    context.Context
+	// steps counts instructions executed by the current Process call,
+	// grant is the part of them not checked against the limits yet
+	steps, grant int
+}
+
+type definition struct {
+	name  string
+	index int
+	compiler
+}
+
+func (e *Evaluator) ReadWord() string {
+	return strings.ToLower(e.input.next())
+}
+
+func NewEvaluator(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		dictionary: make(map[string]int),
+		Output:     os.Stdout,
+		limits:     defaultLimits,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	ops := maps.Clone(primitives)
+	maps.Copy(ops, intPrimitives[e.ints])
+	if e.floats {
+		maps.Copy(ops, floatPrimitives)
+	}
+	for name, op := range ops {
+		e.define(name, []int{int(op)})
+	}
+	e.fence = len(e.words)
+	return e
+}
+
+// Define registers a host function as a word. Like any other word
+// it may be redefined, code compiled earlier keeps calling fn.
+func (e *Evaluator) Define(name string, fn func(*Stack) error) error {
+	name = strings.ToLower(name)
+	if !isValidName(name) {
+		return ErrInvalidDefinitionName
 	}
-	return s[len(s)-1], nil
+	e.define(name, []int{int(opHost), len(e.hosts)})
+	e.hosts = append(e.hosts, host{name: name, fn: fn})
+	return nil
 }
 
-func (s *stack) Pop() (int, error) {
-	if len(*s) == 0 {
-		return 0, ErrStackEmpty
+func (e *Evaluator) define(name string, code []int) {
+	index := e.reserve(name)
+	e.words[index].code = code
+	e.commit(index)
+}
+
+// reserve adds a word that is not visible in the dictionary yet,
+// so that a definition can call itself while being compiled.
+func (e *Evaluator) reserve(name string) int {
+	e.words = append(e.words, &word{
+		name: name,
+		mark: mark{memory: len(e.memory), strings: len(e.strings), hosts: len(e.hosts)},
+	})
+	return len(e.words) - 1
+}
+
+// commit makes the reserved word at index visible in the dictionary.
+func (e *Evaluator) commit(index int) {
+	w := e.words[index]
+	w.shadows = -1
+	if prev, ok := e.dictionary[w.name]; ok {
+		w.shadows = prev
 	}
-	index := len(*s) - 1
-	elem := (*s)[index]
-	*s = (*s)[:index]
-	return elem, nil
+	e.dictionary[w.name] = index
 }
 
-func (s *stack) Over() (int, error) {
-	if len(*s) > 1 {
-		element := (*s)[len(*s)-2]
-		s.Push(element)
-		return element, nil
+// forget drops the word at index with everything defined after it
+// and releases the memory reserved since it was defined.
+func (e *Evaluator) forget(index int) {
+	for i := len(e.words) - 1; i >= index; i-- {
+		w := e.words[i]
+		if e.dictionary[w.name] != i {
+			// redefined or never committed
+			continue
+		}
+		if w.shadows < 0 {
+			delete(e.dictionary, w.name)
+		} else {
+			e.dictionary[w.name] = w.shadows
+		}
 	}
-	return 0, ErrNotEnoughElements
+
+	m := e.words[index].mark
+	clear(e.words[index:])
+	e.words = e.words[:index]
+	e.memory = e.memory[:min(len(e.memory), m.memory)]
+	e.strings = e.strings[:m.strings]
+	e.hosts = e.hosts[:m.hosts]
 }
 
-func (s *stack) Swap() error {
-	top0, _ := s.Pop()
-	top1, err := s.Pop()
-	if err != nil {
-		return err
+// allot reserves n zeroed cells, negative n releases the last cells.
+func (e *Evaluator) allot(n int) error {
+	size := len(e.memory) + n
+	switch {
+	case size < 0:
+		return ErrInvalidAddress
+	case size > e.limits.maxMemory:
+		return ErrOutOfMemory
+	case n < 0:
+		e.memory = e.memory[:size]
+	default:
+		e.memory = append(e.memory, make([]int, n)...)
 	}
-	s.Push(top0)
-	s.Push(top1)
 	return nil
 }
 
-func pushConstant(val int) func(s *stack) error {
-	return func(s *stack) error {
-		s.Push(val)
-		return nil
+// Words returns the names of all defined words in alphabetical order.
+func (e *Evaluator) Words() []string {
+	names := make([]string, 0, len(e.dictionary))
+	for name := range e.dictionary {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-type Evaluator struct {
-	KnownOperation map[string]func(*stack) error
-	Stack          *stack
-	Row            []string
+// Compiling reports whether a definition is waiting for its ";".
+func (e *Evaluator) Compiling() bool {
+	return len(e.pending) > 0
 }
 
-func (e *Evaluator) ReadWord() string {
-	if len(e.Row) == 0 {
-		return ""
+func (e *Evaluator) print(s string) error {
+	_, err := io.WriteString(e.Output, s)
+	return err
+}
+
+func (e *Evaluator) printStack(s Stack) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d> ", len(s))
+	for _, v := range s {
+		b.WriteString(e.formatCell(v) + " ")
 	}
-	word := e.Row[0]
-	e.Row = e.Row[1:]
-	return strings.ToLower(word)
+	return e.print(b.String())
 }
 
-func NewEvaluator() *Evaluator {
-	NewEvaluator := Evaluator{Stack: new(stack)}
-	knownOperation := map[string]func(*stack) error{
-		"+": func(s *stack) error {
-			a, _ := s.Pop()
-			b, err := s.Pop()
-			if err != nil {
-				return err
-			}
-			s.Push(b + a)
-			return nil
-		},
-		"-": func(s *stack) error {
-			a, _ := s.Pop()
-			b, err := s.Pop()
+func (e *Evaluator) run(code []int) error {
+	var err error
+	e.Stack, err = e.exec(e.Stack, code)
+	// steps left over are not charged, the next run gets a fresh grant
+	e.grant -= max(e.control.budget, 0)
+	e.control.budget = 0
+	if e.rollback != 0 {
+		e.forget(e.rollback)
+		e.rollback = 0
+	}
+	return err
+}
+
+// checkInterval is the number of steps between checks
+// of the context and the step limit.
+const checkInterval = 1 << 10
+
+// checkpoint accounts for the instructions granted by the previous call
+// and returns how many more may run before the next one.
+func (e *Evaluator) checkpoint() (int, error) {
+	if e.ctx != nil {
+		select {
+		case <-e.ctx.Done():
+			return 0, e.ctx.Err()
+		default:
+		}
+	}
+
+	e.steps += e.grant
+	e.grant = 0
+	limit := e.limits.maxSteps
+	if limit > 0 && e.steps >= limit {
+		return 0, ErrStepLimitExceeded
+	}
+	e.grant = checkInterval
+	if limit > 0 {
+		e.grant = min(e.grant, limit-e.steps)
+	}
+	return e.grant, nil
+}
+
+// step accounts for the step that exhausted the budget of checkpoint.
+func (e *Evaluator) step() (int, error) {
+	budget, err := e.checkpoint()
+	return budget - 1, err
+}
+
+// clampStack checks the stack depth limit and shrinks the capacity
+// of s to it, so that exec only has to check the limit when s grows.
+func (e *Evaluator) clampStack(s Stack) (Stack, error) {
+	limit := e.limits.maxStackDepth
+	if limit == 0 {
+		return s, nil
+	}
+	if len(s) > limit {
+		return s, ErrStackOverflow
+	}
+	return s[:len(s):min(cap(s), limit)], nil
+}
+
+// grow makes room for one more value on a full stack.
+func (e *Evaluator) grow(s Stack) (Stack, error) {
+	size := max(2*cap(s), 16)
+	if limit := e.limits.maxStackDepth; limit > 0 {
+		if cap(s) >= limit {
+			return s, ErrStackOverflow
+		}
+		size = min(size, limit)
+	}
+	grown := make(Stack, len(s), size)
+	copy(grown, s)
+	return grown, nil
+}
+
+// isTail reports whether the code at pc returns without doing anything else.
+func isTail(code []int, pc int) bool {
+	if pc >= len(code) {
+		return true
+	}
+	switch opcode(code[pc]) {
+	case opExit:
+		return true
+	case opJump:
+		return code[pc+1] >= len(code)
+	}
+	return false
+}
+
+// exec is the dispatch loop of the virtual machine. Primitives are executed
+// inline, user words are called through their index in e.words.
+// Calls are kept on an explicit stack of frames rather than the Go stack,
+// and a call in tail position reuses the frame of the caller.
+// The stack is threaded through by value so that it stays in registers.
+//
+// Straight-line code always terminates, so limits are only checked on steps:
+// taken jumps, calls and returns.
+func (e *Evaluator) exec(s Stack, code []int) (Stack, error) {
+	r := &e.control
+	r.calls, r.cells, r.base = r.calls[:0], r.cells[:0], 0
+
+	s, err := e.clampStack(s)
+	if err != nil {
+		return s, err
+	}
+	if r.budget, err = e.checkpoint(); err != nil {
+		return s, err
+	}
+
+	pc := 0
+	for {
+		if pc >= len(code) {
+			if len(r.calls) == 0 {
+				return s, nil
+			}
+			if r.budget--; r.budget < 0 {
+				if r.budget, err = e.step(); err != nil {
+					return s, err
+				}
+			}
+			f := r.calls[len(r.calls)-1]
+			r.calls = r.calls[:len(r.calls)-1]
+			r.cells = r.cells[:r.base]
+			code, pc, r.base = f.code, f.pc, f.rbase
+			continue
+		}
+
+		op := opcode(code[pc])
+		pc++
+		n := len(s)
+		switch op {
+		case opAdd:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] += s[n-1]
+			s = s[:n-1]
+		case opSub:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] -= s[n-1]
+			s = s[:n-1]
+		case opMul:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] *= s[n-1]
+			s = s[:n-1]
+		case opDiv:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			if s[n-1] == 0 {
+				return s, ErrDivideByZero
+			}
+			s[n-2] /= s[n-1]
+			s = s[:n-1]
+		case opEq:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] = boolToInt(s[n-2] == s[n-1])
+			s = s[:n-1]
+		case opLt:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] = boolToInt(s[n-2] < s[n-1])
+			s = s[:n-1]
+		case opGt:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] = boolToInt(s[n-2] > s[n-1])
+			s = s[:n-1]
+		case opAnd:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] &= s[n-1]
+			s = s[:n-1]
+		case opOr:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] |= s[n-1]
+			s = s[:n-1]
+		case opInvert:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			s[n-1] = ^s[n-1]
+		case opDup:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, s[n-1])
+		case opOver:
+			if n < 2 {
+				return s, ErrNotEnoughElements
+			}
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, s[n-2])
+		case opDrop:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			s = s[:n-1]
+		case opSwap:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2], s[n-1] = s[n-1], s[n-2]
+		case opStore:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			addr := s[n-1]
+			if addr < 0 || addr >= len(e.memory) {
+				return s, ErrInvalidAddress
+			}
+			e.memory[addr] = s[n-2]
+			s = s[:n-2]
+		case opFetch:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			addr := s[n-1]
+			if addr < 0 || addr >= len(e.memory) {
+				return s, ErrInvalidAddress
+			}
+			s[n-1] = e.memory[addr]
+		case opAddStore:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			addr := s[n-1]
+			if addr < 0 || addr >= len(e.memory) {
+				return s, ErrInvalidAddress
+			}
+			e.memory[addr] += s[n-2]
+			s = s[:n-2]
+		case opAllot:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			if err := e.allot(s[n-1]); err != nil {
+				return s, err
+			}
+			s = s[:n-1]
+		case opHere:
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, len(e.memory))
+		case opCells:
+			// addresses count cells, so cells is the identity
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+		case opDot:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			if err := e.print(e.formatCell(s[n-1]) + " "); err != nil {
+				return s, err
+			}
+			s = s[:n-1]
+		case opEmit:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			if err := e.print(string(rune(s[n-1]))); err != nil {
+				return s, err
+			}
+			s = s[:n-1]
+		case opCr:
+			if err := e.print("\n"); err != nil {
+				return s, err
+			}
+		case opPrintStack:
+			if err := e.printStack(s); err != nil {
+				return s, err
+			}
+		case opWords:
+			if err := e.print(strings.Join(e.Words(), " ") + "\n"); err != nil {
+				return s, err
+			}
+		case opAddChecked, opSubChecked, opMulChecked, opDivChecked:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			var v int
+			ok := true
+			switch op {
+			case opAddChecked:
+				v, ok = addChecked(s[n-2], s[n-1])
+			case opSubChecked:
+				v, ok = subChecked(s[n-2], s[n-1])
+			case opMulChecked:
+				v, ok = mulChecked(s[n-2], s[n-1])
+			case opDivChecked:
+				if s[n-1] == 0 {
+					return s, ErrDivideByZero
+				}
+				v, ok = divChecked(s[n-2], s[n-1])
+			}
+			if !ok {
+				return s, ErrIntegerOverflow
+			}
+			s[n-2] = v
+			s = s[:n-1]
+		case opAddStoreChecked:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			addr := s[n-1]
+			if addr < 0 || addr >= len(e.memory) {
+				return s, ErrInvalidAddress
+			}
+			v, ok := addChecked(e.memory[addr], s[n-2])
+			if !ok {
+				return s, ErrIntegerOverflow
+			}
+			e.memory[addr] = v
+			s = s[:n-2]
+		case opBigAdd, opBigSub, opBigMul, opBigDiv, opBigAnd, opBigOr:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			v, err := e.bigs.binary(op, s[n-2], s[n-1])
 			if err != nil {
-				return err
-			}
-			s.Push(b - a)
-			return nil
-		},
-		"*": func(s *stack) error {
-			a, _ := s.Pop()
-			b, err := s.Pop()
+				return s, err
+			}
+			s[n-2] = v
+			s = s[:n-1]
+		case opBigInvert:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			v, err := e.bigs.invert(s[n-1])
 			if err != nil {
-				return err
-			}
-			s.Push(b * a)
-			return nil
-		},
-		"/": func(s *stack) error {
-			a, _ := s.Pop()
-			b, err := s.Pop()
+				return s, err
+			}
+			s[n-1] = v
+		case opBigEq, opBigLt, opBigGt:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			s[n-2] = boolToInt(e.bigs.holds(op, s[n-2], s[n-1]))
+			s = s[:n-1]
+		case opBigAddStore:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			addr := s[n-1]
+			if addr < 0 || addr >= len(e.memory) {
+				return s, ErrInvalidAddress
+			}
+			v, err := e.bigs.binary(opBigAdd, e.memory[addr], s[n-2])
 			if err != nil {
-				return err
+				return s, err
+			}
+			e.memory[addr] = v
+			s = s[:n-2]
+		case opFAdd, opFSub, opFMul, opFDiv, opFDot, opFDup, opFDrop, opFSwap, opIntToFloat, opFloatToInt:
+			if s, err = e.execFloat(op, s); err != nil {
+				return s, err
 			}
-			if a == 0 {
-				return ErrDivideByZero
+		case opFPush:
+			if err := e.pushFloat(math.Float64frombits(uint64(code[pc]))); err != nil {
+				return s, err
 			}
-			s.Push(b / a)
-			return nil
-		},
-		"dup": func(s *stack) error {
-			top, err := s.Top()
+			pc++
+		case opPush:
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, code[pc])
+			pc++
+		case opHost:
+			e.hostStack = s
+			err = e.hosts[code[pc]].fn(&e.hostStack)
+			s = e.hostStack
+			e.hostStack = nil
 			if err != nil {
-				return err
+				return s, err
 			}
-			s.Push(top)
-			return nil
-		},
-		"over": func(s *stack) error {
-			_, err := s.Over()
-			return err
-		},
-		"drop": func(s *stack) error {
-			_, err := s.Pop()
-			return err
-		},
-		"swap": func(s *stack) error {
-			return s.Swap()
-		},
+			if s, err = e.clampStack(s); err != nil {
+				return s, err
+			}
+			pc++
+		case opPrint:
+			if err := e.print(e.strings[code[pc]]); err != nil {
+				return s, err
+			}
+			pc++
+		case opMarker:
+			// words may still be called by the running one,
+			// of several markers the earliest one forgets the most
+			if e.rollback == 0 || code[pc] < e.rollback {
+				e.rollback = code[pc]
+			}
+			pc++
+		case opCall:
+			if r.budget--; r.budget < 0 {
+				if r.budget, err = e.step(); err != nil {
+					return s, err
+				}
+			}
+			callee := e.words[code[pc]].code
+			pc++
+			if isTail(code, pc) {
+				r.cells = r.cells[:r.base]
+			} else {
+				if len(r.calls) == maxCallDepth {
+					return s, ErrReturnStackOverflow
+				}
+				r.calls = append(r.calls, callFrame{code: code, pc: pc, rbase: r.base})
+				r.base = len(r.cells)
+			}
+			code, pc = callee, 0
+		case opExit:
+			pc = len(code)
+		case opToR:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			if len(r.cells) == maxReturnStack {
+				return s, ErrReturnStackOverflow
+			}
+			r.cells = append(r.cells, s[n-1])
+			s = s[:n-1]
+		case opFromR:
+			if len(r.cells) == r.base {
+				return s, ErrReturnStackEmpty
+			}
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, r.cells[len(r.cells)-1])
+			r.cells = r.cells[:len(r.cells)-1]
+		case opRFetch:
+			if len(r.cells) == r.base {
+				return s, ErrReturnStackEmpty
+			}
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, r.cells[len(r.cells)-1])
+		case opJump:
+			if r.budget--; r.budget < 0 {
+				if r.budget, err = e.step(); err != nil {
+					return s, err
+				}
+			}
+			pc = code[pc]
+		case opJumpIfZero:
+			if n < 1 {
+				return s, ErrStackEmpty
+			}
+			flag := s[n-1]
+			s = s[:n-1]
+			if flag == forthFalse {
+				if r.budget--; r.budget < 0 {
+					if r.budget, err = e.step(); err != nil {
+						return s, err
+					}
+				}
+				pc = code[pc]
+			} else {
+				pc++
+			}
+		case opDo:
+			if n < 2 {
+				return s, ErrStackEmpty
+			}
+			if len(r.cells)+2 > maxReturnStack {
+				return s, ErrReturnStackOverflow
+			}
+			// loops count cells, so big values can not bound them
+			if e.ints == IntBig && (isBigRef(s[n-2]) || isBigRef(s[n-1])) {
+				return s, ErrIntegerOverflow
+			}
+			// limit below index, as in other Forth systems
+			r.cells = append(r.cells, s[n-2], s[n-1])
+			s = s[:n-2]
+		case opLoop:
+			// r> and >r may have moved the loop parameters of this frame
+			if len(r.cells)-r.base < 2 {
+				return s, ErrReturnStackEmpty
+			}
+			top := len(r.cells) - 1
+			r.cells[top]++
+			if r.cells[top] < r.cells[top-1] {
+				if r.budget--; r.budget < 0 {
+					if r.budget, err = e.step(); err != nil {
+						return s, err
+					}
+				}
+				pc = code[pc]
+			} else {
+				r.cells = r.cells[:top-1]
+				pc++
+			}
+		case opLoopIndex:
+			index := len(r.cells) - 1 - 2*code[pc]
+			if index < r.base {
+				return s, ErrReturnStackEmpty
+			}
+			if n == cap(s) {
+				if s, err = e.grow(s); err != nil {
+					return s, err
+				}
+			}
+			s = append(s, r.cells[index])
+			pc++
+		}
 	}
-	NewEvaluator.KnownOperation = knownOperation
-	return &NewEvaluator
 }
 
-func (e *Evaluator) ProcessValue(value int) {
-	e.Stack.Push(value)
+// controlWords are only valid inside definitions,
+// they are compiled into jumps over the code.
+var controlWords = map[string]bool{
+	"if": true, "else": true, "then": true,
+	"do": true, "loop": true, "i": true, "j": true,
+	"begin": true, "until": true,
+	"exit": true, "recurse": true,
+	">r": true, "r>": true, "r@": true,
+}
+
+type controlFrame struct {
+	word string
+	pc   int
 }
 
-func (e *Evaluator) tokenToOperation(token string) (func(*stack) error, error) {
-	if op, ok := e.KnownOperation[token]; ok {
-		return op, nil
+type compiler struct {
+	code     []int
+	controls []controlFrame
+}
+
+// emit appends an opcode with its operands and returns its position.
+func (c *compiler) emit(op opcode, operands ...int) int {
+	pc := len(c.code)
+	c.code = append(c.code, int(op))
+	c.code = append(c.code, operands...)
+	return pc
+}
+
+// resolve points the operand of the jump at pc to the end of the code.
+func (c *compiler) resolve(pc int) {
+	c.code[pc+1] = len(c.code)
+}
+
+func (c *compiler) push(word string, pc int) {
+	c.controls = append(c.controls, controlFrame{word: word, pc: pc})
+}
+
+func (c *compiler) pop(words ...string) (controlFrame, error) {
+	if len(c.controls) == 0 {
+		return controlFrame{}, ErrInvalidControlStructure
+	}
+	top := c.controls[len(c.controls)-1]
+	for _, w := range words {
+		if top.word == w {
+			c.controls = c.controls[:len(c.controls)-1]
+			return top, nil
+		}
 	}
-	if n, err := strconv.Atoi(token); err == nil {
-		return pushConstant(n), nil
+	return controlFrame{}, ErrInvalidControlStructure
+}
+
+func (c *compiler) loopDepth() int {
+	depth := 0
+	for _, f := range c.controls {
+		if f.word == "do" {
+			depth++
+		}
 	}
-	return nil, ErrUnknownToken(token)
+	return depth
 }
 
-func (e *Evaluator) parseFunctionBody() ([]func(*stack) error, error) {
-	var ops []func(*stack) error
-	for {
-		word := e.ReadWord()
-		if word == "" {
-			return nil, ErrInvalidFunctionDefinition
+func (d *definition) compileControl(word string) error {
+	c := &d.compiler
+	switch word {
+	case "exit":
+		c.emit(opExit)
+	case "recurse":
+		c.emit(opCall, d.index)
+	case ">r":
+		c.emit(opToR)
+	case "r>":
+		c.emit(opFromR)
+	case "r@":
+		c.emit(opRFetch)
+	case "if":
+		c.push(word, c.emit(opJumpIfZero, 0))
+	case "else":
+		f, err := c.pop("if")
+		if err != nil {
+			return err
 		}
-		if word == ";" {
-			break
+		c.push(word, c.emit(opJump, 0))
+		c.resolve(f.pc)
+	case "then":
+		f, err := c.pop("if", "else")
+		if err != nil {
+			return err
 		}
-		if word == ":" {
-			if err := e.AddFunction(); err != nil {
-				return nil, err
-			}
-			continue
+		c.resolve(f.pc)
+	case "begin":
+		c.push(word, len(c.code))
+	case "until":
+		f, err := c.pop("begin")
+		if err != nil {
+			return err
+		}
+		c.emit(opJumpIfZero, f.pc)
+	case "do":
+		c.emit(opDo)
+		c.push(word, len(c.code))
+	case "loop":
+		f, err := c.pop("do")
+		if err != nil {
+			return err
+		}
+		c.emit(opLoop, f.pc)
+	case "i", "j":
+		level := 0
+		if word == "j" {
+			level = 1
 		}
-		op, err := e.tokenToOperation(word)
+		if c.loopDepth() <= level {
+			return ErrInvalidControlStructure
+		}
+		c.emit(opLoopIndex, level)
+	}
+	return nil
+}
+
+// inlinable reports whether code may be copied into another definition.
+// Jump targets are absolute and return stack words work on the frame
+// of the running word, so code using them is always called.
+func inlinable(code []int) bool {
+	if len(code) > maxInlineSize {
+		return false
+	}
+	for pc := 0; pc < len(code); pc++ {
+		op := opcode(code[pc])
+		if op.isJump() || op.usesFrame() {
+			return false
+		}
+		if op.hasOperand() {
+			pc++
+		}
+	}
+	return true
+}
+
+func (e *Evaluator) compileToken(c *compiler, token string) error {
+	if index, ok := e.dictionary[token]; ok {
+		// primitives and short straight-line words are inlined,
+		// which also binds them early
+		if code := e.words[index].code; inlinable(code) {
+			c.code = append(c.code, code...)
+		} else {
+			c.emit(opCall, index)
+		}
+		return nil
+	}
+	if op, v, ok, err := e.literal(token); ok {
 		if err != nil {
-			return nil, err
+			return err
 		}
-		ops = append(ops, op)
+		c.emit(op, v)
+		return nil
 	}
-	return ops, nil
+	return ErrUnknownToken(token)
+}
+
+// compileWord adds word to the innermost pending definition.
+func (e *Evaluator) compileWord(word string) error {
+	d := e.pending[len(e.pending)-1]
+	switch {
+	case word == ";":
+		if len(d.controls) != 0 {
+			return ErrInvalidControlStructure
+		}
+		e.pending = e.pending[:len(e.pending)-1]
+		e.words[d.index].code = d.code
+		e.commit(d.index)
+		return nil
+	case word == ":":
+		return e.AddFunction()
+	case word == ".\"":
+		text, ok := e.input.until('"')
+		if !ok {
+			return ErrUnterminatedString
+		}
+		d.emit(opPrint, len(e.strings))
+		e.strings = append(e.strings, text)
+		return nil
+	case controlWords[word]:
+		return d.compileControl(word)
+	case definingWords[word]:
+		return ErrInterpretOnlyWord(word)
+	}
+	return e.compileToken(&d.compiler, word)
+}
+
+// definingWords read the name of a new word from the input,
+// they are only valid outside of definitions.
+var definingWords = map[string]bool{
+	"variable": true,
+	"constant": true,
+	"forget":   true,
+	"marker":   true,
+}
+
+func isValidName(name string) bool {
+	return name != "" && !isNumeric(name) && !controlWords[name] && !definingWords[name]
 }
 
 func (e *Evaluator) AddFunction() error {
 	fname := e.ReadWord()
 
-	if fname == "" || isNumeric(fname) {
+	if !isValidName(fname) {
 		return ErrInvalidFunctionDefinition
 	}
 
-	operationsSequence, err := e.parseFunctionBody()
-	if err != nil {
+	e.pending = append(e.pending, &definition{name: fname, index: e.reserve(fname)})
+	return nil
+}
+
+// AddVariable handles "VARIABLE name": it reserves a cell
+// and defines name to push its address.
+func (e *Evaluator) AddVariable() error {
+	name := e.ReadWord()
+	if !isValidName(name) {
+		return ErrInvalidDefinitionName
+	}
+
+	// the cell is reserved after the word, so forgetting the word releases it
+	index := e.reserve(name)
+	addr := len(e.memory)
+	if err := e.allot(1); err != nil {
 		return err
 	}
+	e.words[index].code = []int{int(opPush), addr}
+	e.commit(index)
+	return nil
+}
 
-	e.KnownOperation[fname] = func(s *stack) error {
-		for _, op := range operationsSequence {
-			if err := op(s); err != nil {
-				return err
-			}
-		}
-		return nil
+// AddConstant handles "x CONSTANT name": name pushes x.
+func (e *Evaluator) AddConstant() error {
+	name := e.ReadWord()
+	if !isValidName(name) {
+		return ErrInvalidDefinitionName
 	}
 
+	n := len(e.Stack)
+	if n < 1 {
+		return ErrStackEmpty
+	}
+	value := e.Stack[n-1]
+	e.Stack = e.Stack[:n-1]
+	e.define(name, []int{int(opPush), value})
 	return nil
 }
 
-func (e *Evaluator) AddRow(row string) error {
-	e.Row = append(e.Row, strings.Fields(row)...)
+// Forget handles "FORGET name": it drops the latest definition of name
+// together with every word defined after it.
+func (e *Evaluator) Forget() error {
+	name := e.ReadWord()
+	index, ok := e.dictionary[name]
+	if !ok {
+		return ErrUnknownToken(name)
+	}
+	if index < e.fence {
+		return ErrBuiltinWord(name)
+	}
+	e.forget(index)
 	return nil
 }
 
-func (e *Evaluator) ProcessOperation(fname string) error {
-	f := e.KnownOperation[fname]
-	return f(e.Stack)
+// AddMarker handles "MARKER name": running name forgets itself
+// together with every word defined after it.
+func (e *Evaluator) AddMarker() error {
+	name := e.ReadWord()
+	if !isValidName(name) {
+		return ErrInvalidDefinitionName
+	}
+
+	index := e.reserve(name)
+	e.words[index].code = []int{int(opMarker), index}
+	e.commit(index)
+	return nil
 }
 
 func (e *Evaluator) ProcessWord(word string) error {
+	// comments are skipped both while interpreting and compiling
+	switch word {
+	case "(":
+		e.input.until(')')
+		return nil
+	case "\\":
+		e.input.skipLine()
+		return nil
+	}
+
+	if e.Compiling() {
+		return e.compileWord(word)
+	}
+
 	if word == ":" {
 		return e.AddFunction()
-	} else if _, ok := e.KnownOperation[word]; ok {
-		return e.ProcessOperation(word)
-	} else if intValue, err := strconv.Atoi(word); err == nil {
-		e.ProcessValue(intValue)
-		return err
+	} else if word == "variable" {
+		return e.AddVariable()
+	} else if word == "constant" {
+		return e.AddConstant()
+	} else if word == "forget" {
+		return e.Forget()
+	} else if word == "marker" {
+		return e.AddMarker()
+	} else if word == ".\"" {
+		text, ok := e.input.until('"')
+		if !ok {
+			return ErrUnterminatedString
+		}
+		return e.print(text)
+	} else if controlWords[word] {
+		return ErrCompileOnlyWord(word)
+	} else if index, ok := e.dictionary[word]; ok {
+		return e.run(e.words[index].code)
+	} else if op, v, ok, err := e.literal(word); ok {
+		if err != nil {
+			return err
+		}
+		return e.pushLiteral(op, v)
 	}
 	return ErrUnprocessableEntity(word)
 }
 
+// Process evaluates a line of input. A definition left open
+// at the end of the line continues on the next one.
+// In IntBig mode it fails with ErrIntegerOverflow when the stack holds
+// values that do not fit an int, they stay on the stack for BigStack.
 func (e *Evaluator) Process(row string) ([]int, error) {
+	return e.ProcessContext(context.Background(), row)
+}
 
-	e.Row = strings.Fields(row)
+// ProcessContext is like Process but stops with ctx.Err() once ctx is done.
+// The step limit applies to each call separately.
+func (e *Evaluator) ProcessContext(ctx context.Context, row string) ([]int, error) {
+	e.ctx = ctx
+	defer func() { e.ctx = nil }()
+	e.steps, e.grant = 0, 0
+
+	e.line++
+	e.input = scanner{src: row}
 	for word := e.ReadWord(); word != ""; word = e.ReadWord() {
 		err := e.ProcessWord(word)
 		if err != nil {
-			return []int{}, err
+			e.pending = nil
+			e.collectBigs()
+			return []int{}, &PositionError{Line: e.line, Column: e.input.column, Err: err}
 		}
 	}
-	return *e.Stack, nil
+	e.collectBigs()
+	if e.ints == IntBig {
+		return e.intStack()
+	}
+	return e.Stack, nil
+}
+
+// Run processes r line by line, it fails if a definition is left unterminated.
+func (e *Evaluator) Run(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if _, err := e.ProcessContext(ctx, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if e.Compiling() {
+		return ErrInvalidFunctionDefinition
+	}
+	return nil
 }
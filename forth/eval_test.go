@@ -1,6 +1,11 @@
-package main
+package forth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -249,6 +254,321 @@ var testCases = []testCase{
 		input:       []string{": foo dup ;", ": dup 1 ;", "2 foo"},
 		expected:    []int{2, 2},
 	},
+	{
+		description: "comparison",
+		input:       []string{"1 1 = 1 2 = 1 2 < 2 1 < 2 1 >"},
+		expected:    []int{-1, 0, -1, 0, -1},
+	},
+	{
+		description: "logic",
+		input:       []string{"-1 0 and -1 0 or 0 invert 6 3 and"},
+		expected:    []int{0, -1, -1, 2},
+	},
+	{
+		description: "comparison arity",
+		input:       []string{"1 <"},
+		error:       true,
+	},
+	{
+		description: "if then",
+		input:       []string{": abs dup 0 < if 0 swap - then ;", "-3 abs 4 abs"},
+		expected:    []int{3, 4},
+	},
+	{
+		description: "if else then",
+		input:       []string{": sign 0 > if 1 else -1 then ;", "5 sign -5 sign"},
+		expected:    []int{1, -1},
+	},
+	{
+		description: "nested if else",
+		input:       []string{": 2dup over over ;", ": cmp 2dup = if drop drop 0 else < if -1 else 1 then then ;", "1 2 cmp 2 2 cmp 3 2 cmp"},
+		expected:    []int{-1, 0, 1},
+	},
+	{
+		description: "do loop",
+		input:       []string{": countup 5 0 do i loop ;", "countup"},
+		expected:    []int{0, 1, 2, 3, 4},
+	},
+	{
+		description: "nested do loop",
+		input:       []string{": grid 2 0 do 3 0 do j 10 * i + loop loop ;", "grid"},
+		expected:    []int{0, 1, 2, 10, 11, 12},
+	},
+	{
+		description: "do loop runs at least once",
+		input:       []string{": once 0 0 do 7 loop ;", "once"},
+		expected:    []int{7},
+	},
+	{
+		description: "begin until",
+		input:       []string{": countdown begin dup 1 - dup 0 = until ;", "3 countdown"},
+		expected:    []int{3, 2, 1, 0},
+	},
+	{
+		description: "CONTROL case insensitivity",
+		input:       []string{": foo IF 1 ELSE 2 THEN ;", "0 foo"},
+		expected:    []int{2},
+	},
+	{
+		description: "unterminated if",
+		input:       []string{": foo if 1 ;"},
+		error:       true,
+	},
+	{
+		description: "then without if",
+		input:       []string{": foo then ;"},
+		error:       true,
+	},
+	{
+		description: "loop without do",
+		input:       []string{": foo begin loop ;"},
+		error:       true,
+	},
+	{
+		description: "i outside of loop",
+		input:       []string{": foo i ;"},
+		error:       true,
+	},
+	{
+		description: "if outside of definition",
+		input:       []string{"1 if 2 then"},
+		error:       true,
+	},
+	{
+		description: "if on empty stack",
+		input:       []string{": foo if 1 then ;", "foo"},
+		error:       true,
+	},
+	{
+		description: "redefine control word",
+		input:       []string{": if 1 ;"},
+		error:       true,
+	},
+	{
+		description: "variable",
+		input:       []string{"variable x", "42 x !", "x @ x @"},
+		expected:    []int{42, 42},
+	},
+	{
+		description: "variables are distinct",
+		input:       []string{"variable a variable b", "1 a ! 2 b !", "a @ b @"},
+		expected:    []int{1, 2},
+	},
+	{
+		description: "variable starts at zero",
+		input:       []string{"variable x", "x @"},
+		expected:    []int{0},
+	},
+	{
+		description: "add store",
+		input:       []string{"variable counter", ": inc 1 counter +! ;", "inc inc inc counter @"},
+		expected:    []int{3},
+	},
+	{
+		description: "variable state across lines",
+		input:       []string{"variable acc", ": add acc @ + acc ! ;", "3 add", "4 add", "acc @"},
+		expected:    []int{7},
+	},
+	{
+		description: "constant",
+		input:       []string{"10 constant ten", ": twenty ten ten + ;", "twenty ten"},
+		expected:    []int{20, 10},
+	},
+	{
+		description: "constant without value",
+		input:       []string{"constant x"},
+		error:       true,
+	},
+	{
+		description: "VARIABLE case insensitivity",
+		input:       []string{"VARIABLE X", "5 x !", "X @"},
+		expected:    []int{5},
+	},
+	{
+		description: "here and allot",
+		input:       []string{"here 3 cells allot here swap -"},
+		expected:    []int{3},
+	},
+	{
+		description: "allot array",
+		input:       []string{"variable arr 2 allot", "7 arr 2 + !", "arr 2 + @ arr 1 + @"},
+		expected:    []int{7, 0},
+	},
+	{
+		description: "fetch out of bounds",
+		input:       []string{"variable x", "x 1 + @"},
+		error:       true,
+	},
+	{
+		description: "store negative address",
+		input:       []string{"1 -1 !"},
+		error:       true,
+	},
+	{
+		description: "allot too much",
+		input:       []string{"100000000 allot"},
+		error:       true,
+	},
+	{
+		description: "negative allot below zero",
+		input:       []string{"-1 allot"},
+		error:       true,
+	},
+	{
+		description: "variable inside definition",
+		input:       []string{": foo variable x ;"},
+		error:       true,
+	},
+	{
+		description: "invalid variable name",
+		input:       []string{"variable 1"},
+		error:       true,
+	},
+	{
+		description: "paren comment",
+		input:       []string{"1 ( 2 3 ) 4"},
+		expected:    []int{1, 4},
+	},
+	{
+		description: "line comment",
+		input:       []string{"1 \\ 2 3", "4"},
+		expected:    []int{1, 4},
+	},
+	{
+		description: "comment in definition",
+		input:       []string{": foo ( n -- n n ) dup ;", "1 foo"},
+		expected:    []int{1, 1},
+	},
+	{
+		description: "multi-line definition",
+		input:       []string{": foo", "1", "2 ;", "foo"},
+		expected:    []int{1, 2},
+	},
+	{
+		description: "multi-line control structure",
+		input:       []string{": foo 0 > if", "1 else", "2 then ;", "5 foo"},
+		expected:    []int{1},
+	},
+	{
+		description: "dot consumes value",
+		input:       []string{"1 2 ."},
+		expected:    []int{1},
+	},
+	{
+		description: "nothing to dot",
+		input:       []string{"."},
+		error:       true,
+	},
+	{
+		description: "unterminated string",
+		input:       []string{": foo .\" hello ;"},
+		error:       true,
+	},
+	{
+		description: "recurse",
+		input:       []string{": fact dup 1 > if dup 1 - recurse * then ;", "5 fact"},
+		expected:    []int{120},
+	},
+	{
+		description: "recurse twice",
+		input:       []string{": fib dup 1 > if dup 1 - recurse swap 2 - recurse + then ;", "10 fib"},
+		expected:    []int{55},
+	},
+	{
+		description: "recurse binds to the definition being compiled",
+		input:       []string{": foo 1 ;", ": foo dup 0 > if 1 - recurse then ;", "3 foo"},
+		expected:    []int{0},
+	},
+	{
+		description: "recurse outside of definition",
+		input:       []string{"recurse"},
+		error:       true,
+	},
+	{
+		description: "return stack",
+		input:       []string{": rot >r swap r> swap ;", "1 2 3 rot"},
+		expected:    []int{2, 3, 1},
+	},
+	{
+		description: "r@",
+		input:       []string{": foo >r r@ r@ r> ;", "7 foo"},
+		expected:    []int{7, 7, 7},
+	},
+	{
+		description: "empty return stack",
+		input:       []string{": foo r> ;", "foo"},
+		error:       true,
+	},
+	{
+		description: "return stack of caller is not visible",
+		input:       []string{": inner r> ;", ": outer 1 >r inner ;", "outer"},
+		error:       true,
+	},
+	{
+		description: "return stack is dropped on return",
+		input:       []string{": foo 1 >r ;", ": bar foo 2 ;", "bar"},
+		expected:    []int{2},
+	},
+	{
+		description: "return stack outside of definition",
+		input:       []string{"1 >r"},
+		error:       true,
+	},
+	{
+		description: "exit",
+		input:       []string{": foo 1 exit 2 ;", "foo"},
+		expected:    []int{1},
+	},
+	{
+		description: "exit from loop",
+		input:       []string{": find 10 0 do i 3 = if i exit then loop -1 ;", ": bar find 1 + ;", "bar"},
+		expected:    []int{4},
+	},
+	{
+		description: "i after return stack use in loop body",
+		input:       []string{": foo 3 0 do i >r r> loop ;", "foo"},
+		expected:    []int{0, 1, 2},
+	},
+	{
+		description: "loop after dropping loop parameters",
+		input:       []string{": f 3 0 do r> drop loop ;", "f"},
+		error:       true,
+	},
+	{
+		description: "loop after taking loop parameters",
+		input:       []string{": f 3 0 do r> r> loop ;", "f"},
+		error:       true,
+	},
+	{
+		description: "i after dropping loop parameters",
+		input:       []string{": f 3 0 do r> drop r> drop i loop ;", "f"},
+		error:       true,
+	},
+	{
+		description: "j after dropping outer loop parameters",
+		input:       []string{": f 2 0 do 2 0 do r> drop r> drop r> drop j loop loop ;", "f"},
+		error:       true,
+	},
+	{
+		description: "deep tail recursion",
+		input:       []string{": count dup 0 > if 1 - recurse then ;", "1000000 count"},
+		expected:    []int{0},
+	},
+	{
+		description: "deep tail recursion through else",
+		input:       []string{": count dup 0 = if else 1 - recurse then ;", "1000000 count"},
+		expected:    []int{0},
+	},
+	{
+		description: "call depth overflow",
+		input:       []string{": down dup 0 > if 1 - recurse 1 + then ;", "1000000 down"},
+		error:       true,
+	},
+	{
+		description: "infinite recursion",
+		input:       []string{": forever recurse 1 ;", "forever"},
+		error:       true,
+	},
 }
 
 func TestEval(t *testing.T) {
@@ -267,6 +587,7 @@ func TestEval(t *testing.T) {
 
 func eval(input []string) ([]int, error) {
 	e := NewEvaluator()
+	e.Output = io.Discard
 	var stack []int
 	for _, row := range input {
 		var err error
@@ -277,3 +598,266 @@ func eval(input []string) ([]int, error) {
 	}
 	return stack, nil
 }
+
+func TestEval_CallDepth(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Process(": down dup 0 > if 1 - recurse 1 + then ;")
+	require.NoError(t, err)
+
+	stack, err := e.Process(fmt.Sprint(maxCallDepth, " down"))
+	require.NoError(t, err)
+	require.Equal(t, []int{maxCallDepth}, stack)
+
+	_, err = e.Process(fmt.Sprint(maxCallDepth+1, " down"))
+	require.ErrorIs(t, err, ErrReturnStackOverflow)
+}
+
+func TestDefine(t *testing.T) {
+	e := NewEvaluator()
+	require.NoError(t, e.Define("MAX", func(s *Stack) error {
+		b, err := s.Pop()
+		if err != nil {
+			return err
+		}
+		a, err := s.Pop()
+		if err != nil {
+			return err
+		}
+		s.Push(max(a, b))
+		return nil
+	}))
+	require.NoError(t, e.Define("even?", func(s *Stack) error {
+		v, err := s.Pop()
+		if err != nil {
+			return err
+		}
+		s.PushBool(v%2 == 0)
+		return nil
+	}))
+
+	stack, err := e.Process("3 8 max 2 Max even?")
+	require.NoError(t, err)
+	require.Equal(t, []int{-1}, stack)
+
+	_, err = e.Process(": clamp 0 max ; -5 clamp")
+	require.NoError(t, err)
+	require.Equal(t, []int{-1, 0}, []int(e.Stack))
+
+	_, err = e.Process("drop drop max")
+	require.ErrorIs(t, err, ErrStackEmpty)
+
+	hostErr := errors.New("host failure")
+	require.NoError(t, e.Define("fail", func(s *Stack) error { return hostErr }))
+	_, err = e.Process("fail")
+	require.ErrorIs(t, err, hostErr)
+
+	require.ErrorIs(t, e.Define("42", func(s *Stack) error { return nil }), ErrInvalidDefinitionName)
+	require.ErrorIs(t, e.Define("if", func(s *Stack) error { return nil }), ErrInvalidDefinitionName)
+}
+
+func TestStack(t *testing.T) {
+	var s Stack
+	s.Push(1)
+	s.Push(2)
+	s.PushBool(true)
+	require.Equal(t, 3, s.Len())
+
+	top, err := s.Peek(0)
+	require.NoError(t, err)
+	require.Equal(t, -1, top)
+	_, err = s.Peek(3)
+	require.ErrorIs(t, err, ErrNotEnoughElements)
+
+	b, err := s.PopBool()
+	require.NoError(t, err)
+	require.True(t, b)
+
+	values, err := s.PopN(2)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, values)
+
+	_, err = s.Pop()
+	require.ErrorIs(t, err, ErrStackEmpty)
+	_, err = s.PopN(1)
+	require.ErrorIs(t, err, ErrNotEnoughElements)
+}
+
+func TestOutput(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		input       []string
+		expected    string
+	}{
+		{description: "dot", input: []string{"1 2 . ."}, expected: "2 1 "},
+		{description: "emit and cr", input: []string{"72 emit 105 emit cr"}, expected: "Hi\n"},
+		{description: "string literal", input: []string{`." hello,  world"`}, expected: "hello,  world"},
+		{description: "compiled string", input: []string{`: greet ." hi " . ;`, "5 greet 6 greet"}, expected: "hi 5 hi 6 "},
+		{description: "print stack", input: []string{"1 2 3 .s"}, expected: "<3> 1 2 3 "},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			var out strings.Builder
+			e := NewEvaluator()
+			e.Output = &out
+			for _, row := range tc.input {
+				_, err := e.Process(row)
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	var out strings.Builder
+	e := NewEvaluator()
+	e.Output = &out
+
+	_, err := e.Process(": zzz ; : dup-twice dup dup ; words")
+	require.NoError(t, err)
+	require.Contains(t, e.Words(), "zzz")
+	require.Contains(t, e.Words(), "dup-twice")
+	require.Equal(t, strings.Join(e.Words(), " ")+"\n", out.String())
+}
+
+func TestForget(t *testing.T) {
+	e := NewEvaluator()
+
+	_, err := e.Process(": foo 1 ; : foo 2 ; variable v : bar foo ; here")
+	require.NoError(t, err)
+	here := e.Stack[0]
+
+	// the second foo is dropped with everything defined after it,
+	// the first one becomes visible again
+	stack, err := e.Process("drop forget foo foo here")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, here - 1}, stack)
+	require.NotContains(t, e.Words(), "bar")
+	require.NotContains(t, e.Words(), "v")
+
+	_, err = e.Process("forget foo foo")
+	require.Error(t, err)
+
+	_, err = e.Process("forget dup")
+	require.ErrorContains(t, err, ErrBuiltinWord("dup").Error())
+	_, err = e.Process("forget nothing")
+	require.Error(t, err)
+	_, err = e.Process(": f forget dup ;")
+	require.Error(t, err)
+}
+
+func TestMarker(t *testing.T) {
+	e := NewEvaluator()
+
+	_, err := e.Process(": keep 1 ; marker session : keep 2 ; variable v 5 v ! : reset session keep ;")
+	require.NoError(t, err)
+
+	// the rollback takes effect once the running word returns
+	stack, err := e.Process("keep reset keep")
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 2, 1}, stack)
+	require.NotContains(t, e.Words(), "session")
+	require.NotContains(t, e.Words(), "reset")
+
+	_, err = e.Process("marker session variable w session")
+	require.NoError(t, err)
+	require.NotContains(t, e.Words(), "w")
+
+	// of two markers run by one word the earlier one wins
+	_, err = e.Process("marker m1 : kept ; marker m2 : both m1 m2 ; both")
+	require.NoError(t, err)
+	for _, name := range []string{"m1", "kept", "m2", "both"} {
+		require.NotContains(t, e.Words(), name)
+	}
+
+	_, err = e.Process("marker m1 : kept ; marker m2 : both m2 m1 ; both")
+	require.NoError(t, err)
+	require.NotContains(t, e.Words(), "m1")
+}
+
+func TestProcess_ErrorPosition(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Process("1 2 +")
+	require.NoError(t, err)
+
+	_, err = e.Process("  4   0 /")
+	require.ErrorIs(t, err, ErrDivideByZero)
+
+	var posErr *PositionError
+	require.ErrorAs(t, err, &posErr)
+	require.Equal(t, 2, posErr.Line)
+	require.Equal(t, 9, posErr.Column)
+	require.Equal(t, "2:9: integer divide by zero", err.Error())
+}
+
+func TestProcess_ErrorDropsPendingDefinition(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Process(": foo 1 unknown")
+	require.Error(t, err)
+	require.False(t, e.Compiling())
+
+	stack, err := e.Process("2")
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, stack)
+}
+
+func TestRun(t *testing.T) {
+	script := `\ computes 3 factorial
+: fact ( n -- n! )
+  1 swap 1 + 1 do i * loop ;
+3 fact .
+1 0 /
+`
+	var out strings.Builder
+	e := NewEvaluator(WithOutput(&out))
+
+	err := e.Run(context.Background(), strings.NewReader(script))
+	require.Equal(t, "6 ", out.String())
+	require.ErrorIs(t, err, ErrDivideByZero)
+	require.Equal(t, "5:5: integer divide by zero", err.Error())
+
+	err = NewEvaluator().Run(context.Background(), strings.NewReader(": foo 1"))
+	require.ErrorIs(t, err, ErrInvalidFunctionDefinition)
+}
+
+func mustProcess(b *testing.B, e *Evaluator, rows ...string) {
+	b.Helper()
+	for _, row := range rows {
+		if _, err := e.Process(row); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// w16 calls w0 2^16 times through 16 levels of nested definitions.
+func BenchmarkEval_DeepDefinitions(b *testing.B) {
+	e := NewEvaluator()
+	mustProcess(b, e, ": w0 1 + ;")
+	for i := 1; i <= 16; i++ {
+		mustProcess(b, e, fmt.Sprintf(": w%d w%d w%d ;", i, i-1, i-1))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mustProcess(b, e, "0 w16 drop")
+	}
+}
+
+func BenchmarkEval_Recursion(b *testing.B) {
+	e := NewEvaluator()
+	mustProcess(b, e, ": fib dup 1 > if dup 1 - recurse swap 2 - recurse + then ;")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mustProcess(b, e, "20 fib drop")
+	}
+}
+
+func BenchmarkEval_Loop(b *testing.B) {
+	e := NewEvaluator()
+	mustProcess(b, e, ": sum 0 100000 0 do i + loop ;")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mustProcess(b, e, "sum drop")
+	}
+}
@@ -0,0 +1,457 @@
+//go:build !solution
+
+package forth
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// IntMode selects how integer arithmetic handles overflow.
+type IntMode int
+
+const (
+	// IntWrap wraps around on overflow like Go integers do.
+	IntWrap IntMode = iota
+	// IntChecked fails with ErrIntegerOverflow instead of wrapping.
+	IntChecked
+	// IntBig keeps integers of any size. Values that do not fit a cell
+	// are stored aside and the stack holds references to them,
+	// BigStack returns the actual values.
+	IntBig
+)
+
+// intPrimitives replace the arithmetic of IntWrap in the other modes.
+var intPrimitives = map[IntMode]map[string]opcode{
+	IntChecked: {
+		"+":  opAddChecked,
+		"-":  opSubChecked,
+		"*":  opMulChecked,
+		"/":  opDivChecked,
+		"+!": opAddStoreChecked,
+	},
+	IntBig: {
+		"+":      opBigAdd,
+		"-":      opBigSub,
+		"*":      opBigMul,
+		"/":      opBigDiv,
+		"and":    opBigAnd,
+		"or":     opBigOr,
+		"invert": opBigInvert,
+		"=":      opBigEq,
+		"<":      opBigLt,
+		">":      opBigGt,
+		"+!":     opBigAddStore,
+	},
+}
+
+// floatPrimitives work on the float stack, they are defined by WithFloats.
+var floatPrimitives = map[string]opcode{
+	"f+":    opFAdd,
+	"f-":    opFSub,
+	"f*":    opFMul,
+	"f/":    opFDiv,
+	"f.":    opFDot,
+	"fdup":  opFDup,
+	"fdrop": opFDrop,
+	"fswap": opFSwap,
+	"s>f":   opIntToFloat,
+	"f>s":   opFloatToInt,
+}
+
+func addChecked(a, b int) (int, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+func subChecked(a, b int) (int, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+func mulChecked(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if c/b != a || (a == math.MinInt && b == -1) {
+		return c, false
+	}
+	return c, true
+}
+
+// divChecked expects a non-zero divisor.
+func divChecked(a, b int) (int, bool) {
+	if a == math.MinInt && b == -1 {
+		return a, false
+	}
+	return a / b, true
+}
+
+// maxBigValues is the number of cells at the bottom of the int range
+// that are reserved for references to big values in IntBig mode,
+// minCollect is the number of values below which they are never collected.
+const (
+	maxBigValues = 1 << 32
+	minSmall     = math.MinInt + maxBigValues
+	minCollect   = 1 << 10
+)
+
+func isBigRef(c int) bool {
+	return c < minSmall
+}
+
+// bigValues holds the integers of IntBig mode that do not fit a cell.
+// Values are never modified, so cells referencing them may be copied freely.
+type bigValues struct {
+	values []*big.Int
+	// collectAt is the number of values that triggers the next collection
+	collectAt int
+}
+
+// value returns the integer the cell c stands for.
+func (b *bigValues) value(c int) *big.Int {
+	if isBigRef(c) {
+		return b.values[c-math.MinInt]
+	}
+	return big.NewInt(int64(c))
+}
+
+// cell returns the cell standing for v.
+func (b *bigValues) cell(v *big.Int) (int, error) {
+	if v.IsInt64() && v.Int64() >= minSmall {
+		return int(v.Int64()), nil
+	}
+	if len(b.values) == maxBigValues {
+		return 0, ErrOutOfMemory
+	}
+	b.values = append(b.values, v)
+	return math.MinInt + len(b.values) - 1, nil
+}
+
+// smallBinary applies op to cells that fit, it fails on overflow.
+func smallBinary(op opcode, x, y int) (int, bool) {
+	switch op {
+	case opBigAdd:
+		return addChecked(x, y)
+	case opBigSub:
+		return subChecked(x, y)
+	case opBigMul:
+		return mulChecked(x, y)
+	case opBigDiv:
+		if y == 0 {
+			return 0, false
+		}
+		return divChecked(x, y)
+	case opBigAnd:
+		return x & y, true
+	case opBigOr:
+		return x | y, true
+	}
+	return 0, false
+}
+
+// binary applies an arithmetic or bitwise opcode of IntBig mode.
+func (b *bigValues) binary(op opcode, x, y int) (int, error) {
+	if !isBigRef(x) && !isBigRef(y) {
+		if c, ok := smallBinary(op, x, y); ok && !isBigRef(c) {
+			return c, nil
+		}
+	}
+
+	bx, by := b.value(x), b.value(y)
+	z := new(big.Int)
+	switch op {
+	case opBigAdd:
+		z.Add(bx, by)
+	case opBigSub:
+		z.Sub(bx, by)
+	case opBigMul:
+		z.Mul(bx, by)
+	case opBigDiv:
+		if by.Sign() == 0 {
+			return 0, ErrDivideByZero
+		}
+		// truncated like the division of IntWrap
+		z.Quo(bx, by)
+	case opBigAnd:
+		z.And(bx, by)
+	case opBigOr:
+		z.Or(bx, by)
+	}
+	return b.cell(z)
+}
+
+func (b *bigValues) invert(x int) (int, error) {
+	if c := ^x; !isBigRef(x) && !isBigRef(c) {
+		return c, nil
+	}
+	return b.cell(new(big.Int).Not(b.value(x)))
+}
+
+// holds reports whether the comparison op holds for x and y.
+func (b *bigValues) holds(op opcode, x, y int) bool {
+	var c int
+	if !isBigRef(x) && !isBigRef(y) {
+		c = cmp.Compare(x, y)
+	} else {
+		c = b.value(x).Cmp(b.value(y))
+	}
+	switch op {
+	case opBigEq:
+		return c == 0
+	case opBigLt:
+		return c < 0
+	default:
+		return c > 0
+	}
+}
+
+// collectBigs drops the big values that are no longer referenced
+// from the stack, memory or compiled code. Host functions must not
+// keep cells between calls, their values may be dropped.
+func (e *Evaluator) collectBigs() {
+	b := &e.bigs
+	if e.ints != IntBig || len(b.values) < max(b.collectAt, minCollect) {
+		return
+	}
+
+	moved := make(map[int]int)
+	var values []*big.Int
+	move := func(cells []int) {
+		for i, c := range cells {
+			if !isBigRef(c) {
+				continue
+			}
+			to, ok := moved[c]
+			if !ok {
+				to = math.MinInt + len(values)
+				values = append(values, b.values[c-math.MinInt])
+				moved[c] = to
+			}
+			cells[i] = to
+		}
+	}
+	moveCode := func(code []int) {
+		for pc := 0; pc < len(code); pc++ {
+			op := opcode(code[pc])
+			if op == opPush {
+				move(code[pc+1 : pc+2])
+			}
+			if op.hasOperand() {
+				pc++
+			}
+		}
+	}
+
+	move(e.Stack)
+	move(e.memory)
+	for _, w := range e.words {
+		moveCode(w.code)
+	}
+	for _, d := range e.pending {
+		moveCode(d.code)
+	}
+
+	b.values = values
+	b.collectAt = max(2*len(values), minCollect)
+}
+
+// BigStack returns the values of the stack, including the ones
+// of IntBig mode that do not fit a cell.
+func (e *Evaluator) BigStack() []*big.Int {
+	values := make([]*big.Int, len(e.Stack))
+	for i, c := range e.Stack {
+		if e.ints == IntBig {
+			values[i] = new(big.Int).Set(e.bigs.value(c))
+		} else {
+			values[i] = big.NewInt(int64(c))
+		}
+	}
+	return values
+}
+
+// intStack returns the values of the stack of IntBig mode,
+// it fails if some of them do not fit an int.
+func (e *Evaluator) intStack() ([]int, error) {
+	values := make([]int, len(e.Stack))
+	for i, c := range e.Stack {
+		if !isBigRef(c) {
+			values[i] = c
+			continue
+		}
+		v := e.bigs.value(c)
+		if !v.IsInt64() {
+			return []int{}, ErrIntegerOverflow
+		}
+		values[i] = int(v.Int64())
+	}
+	return values, nil
+}
+
+func (e *Evaluator) formatCell(c int) string {
+	if e.ints == IntBig && isBigRef(c) {
+		return e.bigs.value(c).String()
+	}
+	return strconv.Itoa(c)
+}
+
+// parseFloat accepts float literals with a fraction or an exponent,
+// so that integers keep going to the data stack.
+func parseFloat(token string) (float64, bool) {
+	if !strings.ContainsAny(token, ".eE") || !strings.ContainsAny(token, "0123456789") {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(token, 64)
+	return v, err == nil
+}
+
+// literal returns the instruction pushing the number token stands for.
+func (e *Evaluator) literal(token string) (opcode, int, bool, error) {
+	n, err := strconv.Atoi(token)
+	switch {
+	case err == nil && (e.ints != IntBig || !isBigRef(n)):
+		return opPush, n, true, nil
+	case e.ints == IntBig:
+		if v, ok := new(big.Int).SetString(token, 10); ok {
+			c, err := e.bigs.cell(v)
+			return opPush, c, true, err
+		}
+	case e.ints == IntChecked && errors.Is(err, strconv.ErrRange):
+		return opPush, 0, true, ErrIntegerOverflow
+	}
+	if e.floats {
+		if v, ok := parseFloat(token); ok {
+			return opFPush, int(math.Float64bits(v)), true, nil
+		}
+	}
+	return opNop, 0, false, nil
+}
+
+// pushLiteral runs the instruction returned by literal.
+func (e *Evaluator) pushLiteral(op opcode, operand int) error {
+	if op == opFPush {
+		return e.pushFloat(math.Float64frombits(uint64(operand)))
+	}
+	if limit := e.limits.maxStackDepth; limit > 0 && len(e.Stack) >= limit {
+		return ErrStackOverflow
+	}
+	e.Stack.Push(operand)
+	return nil
+}
+
+func (e *Evaluator) pushFloat(v float64) error {
+	if limit := e.limits.maxStackDepth; limit > 0 && len(e.FloatStack) >= limit {
+		return ErrStackOverflow
+	}
+	e.FloatStack = append(e.FloatStack, v)
+	return nil
+}
+
+func (e *Evaluator) popFloat() (float64, error) {
+	n := len(e.FloatStack)
+	if n == 0 {
+		return 0, ErrFloatStackEmpty
+	}
+	v := e.FloatStack[n-1]
+	e.FloatStack = e.FloatStack[:n-1]
+	return v, nil
+}
+
+// intToFloat converts a cell to the nearest float.
+func (e *Evaluator) intToFloat(c int) float64 {
+	if e.ints == IntBig && isBigRef(c) {
+		v, _ := new(big.Float).SetInt(e.bigs.value(c)).Float64()
+		return v
+	}
+	return float64(c)
+}
+
+// floatToInt truncates v towards zero.
+func (e *Evaluator) floatToInt(v float64) (int, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, ErrIntegerOverflow
+	}
+	v = math.Trunc(v)
+	if e.ints == IntBig {
+		i, _ := big.NewFloat(v).Int(nil)
+		return e.bigs.cell(i)
+	}
+	// -2^63 is exact, 2^63 is the first float above the int range
+	if v < math.MinInt || v >= -math.MinInt {
+		return 0, ErrIntegerOverflow
+	}
+	return int(v), nil
+}
+
+// execFloat runs an opcode of floatPrimitives.
+func (e *Evaluator) execFloat(op opcode, s Stack) (Stack, error) {
+	switch op {
+	case opIntToFloat:
+		n := len(s)
+		if n < 1 {
+			return s, ErrStackEmpty
+		}
+		if err := e.pushFloat(e.intToFloat(s[n-1])); err != nil {
+			return s, err
+		}
+		return s[:n-1], nil
+	case opFloatToInt:
+		v, err := e.popFloat()
+		if err != nil {
+			return s, err
+		}
+		c, err := e.floatToInt(v)
+		if err != nil {
+			return s, err
+		}
+		if len(s) == cap(s) {
+			if s, err = e.grow(s); err != nil {
+				return s, err
+			}
+		}
+		return append(s, c), nil
+	case opFDup:
+		n := len(e.FloatStack)
+		if n < 1 {
+			return s, ErrFloatStackEmpty
+		}
+		return s, e.pushFloat(e.FloatStack[n-1])
+	case opFSwap:
+		f := e.FloatStack
+		n := len(f)
+		if n < 2 {
+			return s, ErrFloatStackEmpty
+		}
+		f[n-2], f[n-1] = f[n-1], f[n-2]
+		return s, nil
+	case opFDrop, opFDot:
+		v, err := e.popFloat()
+		if err != nil || op == opFDrop {
+			return s, err
+		}
+		return s, e.print(strconv.FormatFloat(v, 'g', -1, 64) + " ")
+	}
+
+	f := e.FloatStack
+	n := len(f)
+	if n < 2 {
+		return s, ErrFloatStackEmpty
+	}
+	switch op {
+	case opFAdd:
+		f[n-2] += f[n-1]
+	case opFSub:
+		f[n-2] -= f[n-1]
+	case opFMul:
+		f[n-2] *= f[n-1]
+	case opFDiv:
+		f[n-2] /= f[n-1]
+	}
+	e.FloatStack = f[:n-1]
+	return s, nil
+}
@@ -0,0 +1,141 @@
+package forth
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntMode_Wrap(t *testing.T) {
+	e := NewEvaluator()
+
+	stack, err := e.Process(fmt.Sprint(math.MaxInt, " 1 +"))
+	require.NoError(t, err)
+	require.Equal(t, []int{math.MinInt}, stack)
+}
+
+func TestIntMode_Checked(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected []int
+		err      error
+	}{
+		{input: "2 3 + 7 * 5 - 2 /", expected: []int{15}},
+		{input: fmt.Sprint(math.MaxInt, " 1 +"), err: ErrIntegerOverflow},
+		{input: fmt.Sprint(math.MinInt, " 1 -"), err: ErrIntegerOverflow},
+		{input: fmt.Sprint(math.MaxInt, " 2 *"), err: ErrIntegerOverflow},
+		{input: fmt.Sprint(math.MinInt, " -1 *"), err: ErrIntegerOverflow},
+		{input: fmt.Sprint(math.MinInt, " -1 /"), err: ErrIntegerOverflow},
+		{input: "1 0 /", err: ErrDivideByZero},
+		{input: "99999999999999999999", err: ErrIntegerOverflow},
+		{input: ": big 99999999999999999999 ;", err: ErrIntegerOverflow},
+		{input: fmt.Sprint("variable v ", math.MaxInt, " v ! 1 v +!"), err: ErrIntegerOverflow},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			e := NewEvaluator(WithIntMode(IntChecked))
+			stack, err := e.Process(tc.input)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, stack)
+			}
+		})
+	}
+}
+
+func TestIntMode_Big(t *testing.T) {
+	var out bytes.Buffer
+	e := NewEvaluator(WithIntMode(IntBig), WithOutput(&out))
+
+	_, err := e.Process(": fact dup 1 > if dup 1 - recurse * then ;")
+	require.NoError(t, err)
+
+	// values that do not fit an int are only returned by BigStack
+	_, err = e.Process("30 fact dup .")
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+	require.Equal(t, "265252859812191058636308480000000 ", out.String())
+
+	fact30, _ := new(big.Int).SetString("265252859812191058636308480000000", 10)
+	require.Equal(t, []*big.Int{fact30}, e.BigStack())
+
+	// values shrink back into cells
+	stack, err := e.Process("29 fact / 100000000000000000000000 dup 1 + < invert")
+	require.NoError(t, err)
+	require.Equal(t, []int{30, 0}, stack)
+
+	_, err = e.Process("drop drop 1 0 /")
+	require.ErrorIs(t, err, ErrDivideByZero)
+
+	out.Reset()
+	_, err = e.Process(fmt.Sprint("drop drop ", math.MinInt, " 1 - dup 1 + .s"))
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+	require.Equal(t, fmt.Sprintf("<2> -9223372036854775809 %d ", math.MinInt), out.String())
+
+	// literals outside the int range may be compiled and stored in memory
+	stack, err = e.Process("drop drop : big 18446744073709551616 ; variable v big big * v ! v @ big / big =")
+	require.NoError(t, err)
+	require.Equal(t, []int{-1}, stack)
+
+	// values near the ends of the int range are returned as they are
+	stack, err = e.Process(fmt.Sprint("drop ", math.MinInt, " ", math.MaxInt, " 1 + 1 -"))
+	require.NoError(t, err)
+	require.Equal(t, []int{math.MinInt, math.MaxInt}, stack)
+
+	// loops count cells, big bounds are rejected
+	_, err = e.Process("drop drop : count 0 do loop ; 18446744073709551616 count")
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+}
+
+func TestIntMode_BigCollect(t *testing.T) {
+	e := NewEvaluator(WithIntMode(IntBig))
+
+	_, err := e.Process(": big 18446744073709551616 ; variable v big big * v !")
+	require.NoError(t, err)
+	_, err = e.Process(": grow 3000 0 do 2 * loop ;")
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = e.Process("big grow drop")
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(e.bigs.values), 2*minCollect)
+	}
+
+	stack, err := e.Process("v @ big / big =")
+	require.NoError(t, err)
+	require.Equal(t, []int{-1}, stack)
+}
+
+func TestFloats(t *testing.T) {
+	var out bytes.Buffer
+	e := NewEvaluator(WithFloats(), WithOutput(&out))
+
+	_, err := e.Process("1.5 2.5 f+ f. 1e3 4 s>f f/ fdup f.")
+	require.NoError(t, err)
+	require.Equal(t, "4 250 ", out.String())
+	require.Equal(t, []float64{250}, e.FloatStack)
+
+	stack, err := e.Process(": half s>f 0.5 f* f>s ; 7 half 3 1")
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 3, 1}, stack)
+
+	_, err = e.Process("f>s")
+	require.NoError(t, err)
+	require.Empty(t, e.FloatStack)
+
+	_, err = e.Process("f+")
+	require.ErrorIs(t, err, ErrFloatStackEmpty)
+
+	_, err = e.Process("1e300 1e300 f* f>s")
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+
+	// float words and literals are only known with WithFloats
+	_, err = NewEvaluator().Process("1.5")
+	require.Error(t, err)
+	_, err = NewEvaluator().Process("1 s>f")
+	require.Error(t, err)
+}
@@ -0,0 +1,62 @@
+//go:build !solution
+
+package forth
+
+import "io"
+
+type limits struct {
+	maxSteps      int
+	maxStackDepth int
+	maxMemory     int
+}
+
+var defaultLimits = limits{
+	maxMemory: 1 << 20,
+}
+
+// Option configures an Evaluator created by NewEvaluator.
+type Option func(*Evaluator)
+
+// WithMaxSteps bounds the number of steps (taken jumps, calls and returns)
+// a single call to Process may make, zero means no limit.
+func WithMaxSteps(n int) Option {
+	return func(e *Evaluator) {
+		e.limits.maxSteps = n
+	}
+}
+
+// WithMaxStackDepth bounds the number of values on the data stack,
+// zero means no limit.
+func WithMaxStackDepth(n int) Option {
+	return func(e *Evaluator) {
+		e.limits.maxStackDepth = n
+	}
+}
+
+// WithMaxMemory bounds the number of cells VARIABLE and ALLOT may reserve.
+func WithMaxMemory(cells int) Option {
+	return func(e *Evaluator) {
+		e.limits.maxMemory = cells
+	}
+}
+
+// WithOutput sets the writer used by the output words, os.Stdout by default.
+func WithOutput(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.Output = w
+	}
+}
+
+// WithIntMode selects how integer arithmetic handles overflow, IntWrap by default.
+func WithIntMode(mode IntMode) Option {
+	return func(e *Evaluator) {
+		e.ints = mode
+	}
+}
+
+// WithFloats enables float literals and the words working on the float stack.
+func WithFloats() Option {
+	return func(e *Evaluator) {
+		e.floats = true
+	}
+}
@@ -0,0 +1,107 @@
+package forth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits_Steps(t *testing.T) {
+	e := NewEvaluator(WithMaxSteps(10000))
+
+	_, err := e.Process(": forever begin 0 until ;")
+	require.NoError(t, err)
+
+	_, err = e.Process("forever")
+	require.ErrorIs(t, err, ErrStepLimitExceeded)
+
+	// the limit applies to each call separately
+	for i := 0; i < 3; i++ {
+		stack, err := e.Process(": sum 0 1000 0 do i + loop ; sum")
+		require.NoError(t, err)
+		require.Equal(t, []int{499500}, stack)
+		_, err = e.Process("drop")
+		require.NoError(t, err)
+	}
+}
+
+func TestLimits_StepsCheapWords(t *testing.T) {
+	// straight-line words take no steps however many of them run
+	e := NewEvaluator(WithMaxSteps(3000))
+	stack, err := e.Process("1 dup drop dup drop dup drop")
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, stack)
+
+	e = NewEvaluator(WithMaxSteps(100))
+	stack, err = e.Process(": f 1 + ; 1 f f f")
+	require.NoError(t, err)
+	require.Equal(t, []int{4}, stack)
+
+	_, err = e.Process(": g 0 5 0 do i + loop ; g g g g g g g g g g")
+	require.NoError(t, err)
+
+	_, err = e.Process(": forever begin 0 until ; forever")
+	require.ErrorIs(t, err, ErrStepLimitExceeded)
+}
+
+func TestLimits_StackDepth(t *testing.T) {
+	e := NewEvaluator(WithMaxStackDepth(4))
+
+	stack, err := e.Process("1 2 3 4")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3, 4}, stack)
+
+	_, err = e.Process("dup")
+	require.ErrorIs(t, err, ErrStackOverflow)
+
+	_, err = e.Process("5")
+	require.ErrorIs(t, err, ErrStackOverflow)
+
+	e = NewEvaluator(WithMaxStackDepth(100))
+	_, err = e.Process(": flood begin 1 0 until ; flood")
+	require.ErrorIs(t, err, ErrStackOverflow)
+	require.LessOrEqual(t, len(e.Stack), 100)
+
+	e = NewEvaluator(WithMaxStackDepth(2))
+	require.NoError(t, e.Define("three", func(s *Stack) error {
+		s.Push(1)
+		s.Push(2)
+		s.Push(3)
+		return nil
+	}))
+	_, err = e.Process("three")
+	require.ErrorIs(t, err, ErrStackOverflow)
+}
+
+func TestLimits_Memory(t *testing.T) {
+	e := NewEvaluator(WithMaxMemory(2))
+
+	_, err := e.Process("variable a variable b")
+	require.NoError(t, err)
+
+	_, err = e.Process("variable c")
+	require.ErrorIs(t, err, ErrOutOfMemory)
+
+	_, err = e.Process("1 allot")
+	require.ErrorIs(t, err, ErrOutOfMemory)
+}
+
+func TestLimits_Context(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Process(": forever begin 0 until ;")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = e.ProcessContext(ctx, "forever")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	stack, err := e.Process("1 2 +")
+	require.NoError(t, err)
+	require.Equal(t, []int{3}, stack)
+}
@@ -0,0 +1,65 @@
+//go:build !solution
+
+package forth
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// scanner splits a line of input into whitespace separated words
+// and remembers where the last word started.
+type scanner struct {
+	src    string
+	pos    int
+	column int
+}
+
+func (s *scanner) skipSpaces() {
+	for s.pos < len(s.src) {
+		r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		s.pos += size
+	}
+}
+
+// next returns the next word or an empty string at the end of input.
+func (s *scanner) next() string {
+	s.skipSpaces()
+	start := s.pos
+	s.column = utf8.RuneCountInString(s.src[:start]) + 1
+	for s.pos < len(s.src) {
+		r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		s.pos += size
+	}
+	return s.src[start:s.pos]
+}
+
+// until returns the raw text up to delim and skips the delimiter.
+// The single space separating the text from the preceding word is dropped.
+func (s *scanner) until(delim rune) (string, bool) {
+	if s.pos < len(s.src) {
+		if r, size := utf8.DecodeRuneInString(s.src[s.pos:]); unicode.IsSpace(r) {
+			s.pos += size
+		}
+	}
+	start := s.pos
+	for s.pos < len(s.src) {
+		r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+		s.pos += size
+		if r == delim {
+			return s.src[start : s.pos-size], true
+		}
+	}
+	return s.src[start:], false
+}
+
+// skipLine drops the rest of the input.
+func (s *scanner) skipLine() {
+	s.pos = len(s.src)
+}
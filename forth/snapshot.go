@@ -0,0 +1,228 @@
+//go:build !solution
+
+package forth
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// snapshotVersion changes whenever the layout of snapshots
+// or the opcode values stored in compiled code change.
+const snapshotVersion = 1
+
+// snapshot is the state of an Evaluator written by Save.
+// Words are stored compiled, so a loaded word keeps calling
+// the definitions it was compiled against.
+type snapshot struct {
+	Version    int
+	Ints       IntMode
+	Floats     bool
+	Words      []savedWord
+	Fence      int
+	Dictionary map[string]int
+	// Hosts are the names host functions were defined with,
+	// the evaluator loading the snapshot has to define them in the same order
+	Hosts      []string
+	Strings    []string
+	Memory     []int
+	Stack      []int
+	FloatStack []float64
+	Bigs       []*big.Int
+}
+
+type savedWord struct {
+	Name    string
+	Code    []int
+	Shadows int
+	Memory  int
+	Strings int
+	Hosts   int
+}
+
+// Save writes the words, stack, float stack and memory of e to w.
+// It fails while a definition is pending.
+func (e *Evaluator) Save(w io.Writer) error {
+	if e.Compiling() {
+		return ErrInvalidFunctionDefinition
+	}
+
+	s := snapshot{
+		Version:    snapshotVersion,
+		Ints:       e.ints,
+		Floats:     e.floats,
+		Fence:      e.fence,
+		Dictionary: e.dictionary,
+		Strings:    e.strings,
+		Memory:     e.memory,
+		Stack:      e.Stack,
+		FloatStack: e.FloatStack,
+		Bigs:       e.bigs.values,
+	}
+	for _, w := range e.words {
+		s.Words = append(s.Words, savedWord{
+			Name:    w.name,
+			Code:    w.code,
+			Shadows: w.shadows,
+			Memory:  w.mark.memory,
+			Strings: w.mark.strings,
+			Hosts:   w.mark.hosts,
+		})
+	}
+	for _, h := range e.hosts {
+		s.Hosts = append(s.Hosts, h.name)
+	}
+	return gob.NewEncoder(w).Encode(&s)
+}
+
+// Load replaces the state of e with a snapshot written by Save,
+// including the number modes. Host functions used by the snapshot
+// must be defined on e with the same names and in the same order.
+// On error e is left unchanged.
+func (e *Evaluator) Load(r io.Reader) error {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if err := e.validate(&s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	e.ints, e.floats = s.Ints, s.Floats
+	e.words = e.words[:0]
+	for _, w := range s.Words {
+		e.words = append(e.words, &word{
+			name:    w.Name,
+			code:    w.Code,
+			shadows: w.Shadows,
+			mark:    mark{memory: w.Memory, strings: w.Strings, hosts: w.Hosts},
+		})
+	}
+	e.fence = s.Fence
+	e.dictionary = s.Dictionary
+	if e.dictionary == nil {
+		e.dictionary = make(map[string]int)
+	}
+	e.hosts = e.hosts[:len(s.Hosts)]
+	e.strings = s.Strings
+	e.memory = s.Memory
+	e.Stack = s.Stack
+	e.FloatStack = s.FloatStack
+	e.bigs = bigValues{values: s.Bigs}
+	e.pending = nil
+	e.rollback = 0
+	return nil
+}
+
+// validate checks that s refers only to what it contains, so that running
+// a loaded word can not index out of the evaluator state.
+func (e *Evaluator) validate(s *snapshot) error {
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("version %d, expected %d", s.Version, snapshotVersion)
+	}
+	if s.Ints < IntWrap || s.Ints > IntBig {
+		return fmt.Errorf("unknown int mode %d", s.Ints)
+	}
+	if len(s.Hosts) > len(e.hosts) {
+		return fmt.Errorf("%d host functions defined, %d needed", len(e.hosts), len(s.Hosts))
+	}
+	for i, name := range s.Hosts {
+		if e.hosts[i].name != name {
+			return fmt.Errorf("host function %d is %q, expected %q", i, e.hosts[i].name, name)
+		}
+	}
+	if len(s.Memory) > e.limits.maxMemory {
+		return ErrOutOfMemory
+	}
+	if s.Fence < 0 || s.Fence > len(s.Words) {
+		return fmt.Errorf("invalid fence %d", s.Fence)
+	}
+	for name, index := range s.Dictionary {
+		if index < 0 || index >= len(s.Words) || s.Words[index].Name != name {
+			return fmt.Errorf("invalid dictionary entry %q", name)
+		}
+	}
+
+	isCell := func(c int) bool {
+		return s.Ints != IntBig || !isBigRef(c) || c-math.MinInt < len(s.Bigs)
+	}
+	if !allCells(s.Stack, isCell) || !allCells(s.Memory, isCell) {
+		return fmt.Errorf("invalid big value reference")
+	}
+
+	for i, w := range s.Words {
+		if w.Shadows < -1 || w.Shadows >= i ||
+			w.Memory < 0 || w.Strings < 0 || w.Strings > len(s.Strings) || w.Hosts < 0 || w.Hosts > len(s.Hosts) {
+			return fmt.Errorf("invalid word %q", w.Name)
+		}
+		if err := s.validateCode(w.Code, isCell); err != nil {
+			return fmt.Errorf("word %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func allCells(cells []int, ok func(int) bool) bool {
+	return !slices.ContainsFunc(cells, func(c int) bool { return !ok(c) })
+}
+
+// validateCode checks opcodes and their operands.
+// Jumps must land on instructions or the end of code.
+func (s *snapshot) validateCode(code []int, isCell func(int) bool) error {
+	starts := make([]bool, len(code)+1)
+	starts[len(code)] = true
+	for pc := 0; pc < len(code); pc++ {
+		starts[pc] = true
+		op := opcode(code[pc])
+		if op < 0 || op >= opCount {
+			return fmt.Errorf("invalid opcode %d", code[pc])
+		}
+		if op.hasOperand() {
+			pc++
+		}
+	}
+
+	for pc := 0; pc < len(code); pc++ {
+		op := opcode(code[pc])
+		if !op.hasOperand() {
+			continue
+		}
+		pc++
+		if pc == len(code) {
+			return fmt.Errorf("missing operand of opcode %d", op)
+		}
+
+		v := code[pc]
+		var ok bool
+		switch op {
+		case opPush:
+			ok = isCell(v)
+		case opCall:
+			ok = v >= 0 && v < len(s.Words)
+		case opMarker:
+			// rollback relies on markers never being builtin
+			ok = v >= max(s.Fence, 1) && v < len(s.Words)
+		case opJump, opJumpIfZero:
+			ok = v >= 0 && v <= len(code) && starts[v]
+		case opLoop:
+			// loops jump back to the instruction following their do
+			ok = v > 0 && v < pc && starts[v-1] && opcode(code[v-1]) == opDo
+		case opLoopIndex:
+			ok = v == 0 || v == 1
+		case opPrint:
+			ok = v >= 0 && v < len(s.Strings)
+		case opHost:
+			ok = v >= 0 && v < len(s.Hosts)
+		case opFPush:
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("invalid operand %d of opcode %d", v, op)
+		}
+	}
+	return nil
+}
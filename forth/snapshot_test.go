@@ -0,0 +1,126 @@
+package forth
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	var out strings.Builder
+	e := NewEvaluator(WithOutput(&out))
+	_, err := e.Process(`variable counter : inc 1 counter +! ; : greet ." hi " ; inc inc 7 8 marker clean`)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Save(&buf))
+
+	loaded := NewEvaluator(WithOutput(&out))
+	require.NoError(t, loaded.Load(&buf))
+	require.Equal(t, []int{7, 8}, []int(loaded.Stack))
+	require.Equal(t, e.Words(), loaded.Words())
+
+	stack, err := loaded.Process("inc counter @ greet : inc 10 counter +! ; inc counter @")
+	require.NoError(t, err)
+	require.Equal(t, []int{7, 8, 3, 13}, stack)
+	require.Equal(t, "hi ", out.String())
+
+	// markers and forget keep working on the loaded words
+	stack, err = loaded.Process("clean inc counter @")
+	require.NoError(t, err)
+	require.Equal(t, []int{7, 8, 3, 13, 14}, stack)
+	_, err = loaded.Process("forget counter counter")
+	require.Error(t, err)
+}
+
+func TestSnapshot_Modes(t *testing.T) {
+	e := NewEvaluator(WithIntMode(IntBig), WithFloats())
+	_, err := e.Process(": big 18446744073709551616 ; big big * 2.5")
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Save(&buf))
+
+	loaded := NewEvaluator()
+	require.NoError(t, loaded.Load(&buf))
+	require.Equal(t, []float64{2.5}, loaded.FloatStack)
+
+	stack, err := loaded.Process("big / big = 1.5 f>s")
+	require.NoError(t, err)
+	require.Equal(t, []int{-1, 1}, stack)
+}
+
+func TestSnapshot_Hosts(t *testing.T) {
+	double := func(s *Stack) error {
+		v, err := s.Pop()
+		s.Push(2 * v)
+		return err
+	}
+
+	e := NewEvaluator()
+	require.NoError(t, e.Define("double", double))
+	_, err := e.Process(": quad double double ;")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Save(&buf))
+	saved := buf.Bytes()
+
+	require.ErrorIs(t, NewEvaluator().Load(bytes.NewReader(saved)), ErrInvalidSnapshot)
+
+	other := NewEvaluator()
+	require.NoError(t, other.Define("triple", double))
+	require.ErrorIs(t, other.Load(bytes.NewReader(saved)), ErrInvalidSnapshot)
+
+	loaded := NewEvaluator()
+	require.NoError(t, loaded.Define("double", double))
+	require.NoError(t, loaded.Load(bytes.NewReader(saved)))
+	stack, err := loaded.Process("3 quad")
+	require.NoError(t, err)
+	require.Equal(t, []int{12}, stack)
+}
+
+func TestSnapshot_Invalid(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Process(": foo 1 ; 5")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, e.Load(strings.NewReader("garbage")), ErrInvalidSnapshot)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEvaluator().Save(&buf))
+	saved := buf.Bytes()
+
+	for _, corrupt := range []func(s *snapshot){
+		func(s *snapshot) { s.Version++ },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opCount)} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opCall), len(s.Words)} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opJump), 1} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opPush)} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opLoop), 0} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opDup), int(opLoop), 1} },
+		func(s *snapshot) { s.Words[0].Code = []int{int(opLoopIndex), 2} },
+		func(s *snapshot) { s.Dictionary["nothing"] = 0 },
+	} {
+		var s snapshot
+		require.NoError(t, gob.NewDecoder(bytes.NewReader(saved)).Decode(&s))
+		corrupt(&s)
+
+		var corrupted bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&corrupted).Encode(&s))
+		require.ErrorIs(t, e.Load(&corrupted), ErrInvalidSnapshot)
+	}
+
+	// failed loads leave the evaluator unchanged
+	stack, err := e.Process("foo")
+	require.NoError(t, err)
+	require.Equal(t, []int{5, 1}, stack)
+
+	_, err = e.Process(": unfinished")
+	require.NoError(t, err)
+	require.ErrorIs(t, e.Save(io.Discard), ErrInvalidFunctionDefinition)
+}
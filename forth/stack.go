@@ -0,0 +1,55 @@
+//go:build !solution
+
+package forth
+
+// Stack is the data stack. Host functions registered with Define
+// receive it to take their arguments and leave their results.
+type Stack []int
+
+func (s Stack) Len() int {
+	return len(s)
+}
+
+func (s *Stack) Push(v int) {
+	*s = append(*s, v)
+}
+
+func (s *Stack) Pop() (int, error) {
+	if len(*s) == 0 {
+		return 0, ErrStackEmpty
+	}
+	index := len(*s) - 1
+	elem := (*s)[index]
+	*s = (*s)[:index]
+	return elem, nil
+}
+
+// Peek returns the value depth positions below the top, Peek(0) is the top.
+func (s Stack) Peek(depth int) (int, error) {
+	if depth < 0 || depth >= len(s) {
+		return 0, ErrNotEnoughElements
+	}
+	return s[len(s)-1-depth], nil
+}
+
+// PushBool pushes a Forth flag, -1 for true and 0 for false.
+func (s *Stack) PushBool(b bool) {
+	s.Push(boolToInt(b))
+}
+
+// PopBool pops a flag, any non-zero value is true.
+func (s *Stack) PopBool() (bool, error) {
+	v, err := s.Pop()
+	return v != forthFalse, err
+}
+
+// PopN pops n values and returns them in the order they were pushed.
+func (s *Stack) PopN(n int) ([]int, error) {
+	if n < 0 || n > len(*s) {
+		return nil, ErrNotEnoughElements
+	}
+	index := len(*s) - n
+	elems := append([]int(nil), (*s)[index:]...)
+	*s = (*s)[:index]
+	return elems, nil
+}
@@ -0,0 +1,298 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutHeader carries the time left until the deadline of a call.
+// The handler bounds the context of the method by it.
+const TimeoutHeader = "X-Rpc-Timeout"
+
+const (
+	defaultRetries   = 2
+	defaultBackoff   = 50 * time.Millisecond
+	maxBackoffFactor = 32
+)
+
+// Client calls the methods of a JSON-RPC 2.0 endpoint.
+// It reuses connections and is safe for concurrent use.
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	codec      Codec
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	idempotent map[string]bool
+
+	lastID atomic.Int64
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the client send requests with c.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithTransport makes the client send requests with rt.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(client *Client) {
+		client.httpClient = &http.Client{Transport: rt}
+	}
+}
+
+// WithCodec makes the client encode calls with codec, JSON by default.
+func WithCodec(codec Codec) ClientOption {
+	return func(client *Client) {
+		client.codec = codec
+	}
+}
+
+// WithTimeout bounds every call by d, a shorter deadline of the context wins.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.timeout = d
+	}
+}
+
+// WithRetries makes the client retry idempotent methods up to n times.
+// Retries wait backoff, twice as long after each failure, with jitter.
+func WithRetries(n int, backoff time.Duration) ClientOption {
+	return func(client *Client) {
+		client.retries = n
+		client.backoff = backoff
+	}
+}
+
+// WithIdempotent marks methods that are safe to run more than once.
+// Only they are retried, other methods are sent exactly once.
+func WithIdempotent(methods ...string) ClientOption {
+	return func(client *Client) {
+		for _, m := range methods {
+			client.idempotent[m] = true
+		}
+	}
+}
+
+// NewClient returns a client of the endpoint. By default it uses
+// http.DefaultClient, has no timeout and retries idempotent methods twice.
+func NewClient(endpoint string, opts ...ClientOption) *Client {
+	c := &Client{
+		endpoint:   endpoint,
+		httpClient: http.DefaultClient,
+		codec:      JSON,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		idempotent: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Call invokes method at the JSON-RPC 2.0 endpoint and decodes the result into rsp.
+// Errors returned by the method are *Error wrapping the error registered
+// for their code, if there is one.
+func Call(ctx context.Context, endpoint string, method string, req, rsp interface{}) error {
+	return NewClient(endpoint).Call(ctx, method, req, rsp)
+}
+
+// Notify invokes method as a notification, the server sends no result back.
+func Notify(ctx context.Context, endpoint string, method string, req interface{}) error {
+	return NewClient(endpoint).Notify(ctx, method, req)
+}
+
+// CallTyped is Client.Call with the request and response types checked
+// at compile time.
+func CallTyped[Req, Rsp any](ctx context.Context, c *Client, method string, req *Req) (*Rsp, error) {
+	rsp := new(Rsp)
+	if err := c.Call(ctx, method, req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Call invokes method and decodes the result into rsp, see the package level Call.
+func (c *Client) Call(ctx context.Context, method string, req, rsp interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	id, err := c.nextID()
+	if err != nil {
+		return err
+	}
+	body, err := c.post(ctx, method, req, id)
+	if err != nil {
+		return err
+	}
+
+	var response response
+	if err := c.codec.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("error while decoding response: %w", err)
+	}
+	if response.Error != nil {
+		response.Error.resolve()
+		return response.Error
+	}
+	if !bytes.Equal(response.ID, id) {
+		return fmt.Errorf("response id %s does not match request id %s", response.ID, id)
+	}
+	return c.codec.Unmarshal(response.Result, rsp)
+}
+
+func (c *Client) nextID() (RawMessage, error) {
+	id, err := c.codec.Marshal(c.lastID.Add(1))
+	if err != nil {
+		return nil, fmt.Errorf("error while encoding id: %w", err)
+	}
+	return id, nil
+}
+
+// encode encodes the request of a call, a request without id is a notification.
+func (c *Client) encode(method string, req interface{}, id RawMessage) ([]byte, error) {
+	params, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while encoding input struct: %w", err)
+	}
+	payload, err := c.codec.Marshal(&request{JSONRPC: Version, Method: method, Params: params, ID: id})
+	if err != nil {
+		return nil, fmt.Errorf("error while encoding request: %w", err)
+	}
+	return payload, nil
+}
+
+// Notify invokes method as a notification, the server sends no result back.
+func (c *Client) Notify(ctx context.Context, method string, req interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.post(ctx, method, req, nil)
+	return err
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// post sends the request, retrying idempotent methods
+// when the server could not be reached or was unavailable.
+func (c *Client) post(ctx context.Context, method string, req interface{}, id RawMessage) ([]byte, error) {
+	payload, err := c.encode(method, req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := 0
+	if c.idempotent[method] {
+		retries = c.retries
+	}
+	for attempt := 0; ; attempt++ {
+		body, err := c.send(ctx, payload)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= retries {
+			return body, err
+		}
+
+		timer := time.NewTimer(c.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay is the exponential backoff before the retry after attempt, with jitter.
+func (c *Client) delay(attempt int) time.Duration {
+	if c.backoff <= 0 {
+		return 0
+	}
+	d := c.backoff * maxBackoffFactor
+	if attempt < 5 {
+		d = c.backoff << attempt
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryableError is a failure after which an idempotent method may be sent again.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// newRequest creates the http request of a call, it carries the deadline of ctx.
+func (c *Client) newRequest(ctx context.Context, payload []byte) (*http.Request, error) {
+	post, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request: %w", err)
+	}
+	post.Header.Set("Content-Type", c.codec.ContentType())
+	if deadline, ok := ctx.Deadline(); ok {
+		post.Header.Set(TimeoutHeader, time.Until(deadline).String())
+	}
+	return post, nil
+}
+
+func (c *Client) send(ctx context.Context, payload []byte) ([]byte, error) {
+	post, err := c.newRequest(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.httpClient.Do(post)
+	if err != nil {
+		err = fmt.Errorf("error while making request from client: %w", err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
+	}
+
+	defer response.Body.Close()
+	responseBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading response body: %w", err)
+	}
+
+	switch {
+	case response.StatusCode == http.StatusNoContent:
+		return nil, nil
+	case response.StatusCode == http.StatusOK:
+		return responseBytes, nil
+	case hasContentType(response.Header, c.codec.ContentType()):
+		// error objects come with the status of their code
+		return responseBytes, nil
+	case response.StatusCode == http.StatusBadGateway,
+		response.StatusCode == http.StatusServiceUnavailable,
+		response.StatusCode == http.StatusGatewayTimeout:
+		return nil, &retryableError{err: fmt.Errorf("server error: %s", string(responseBytes))}
+	default:
+		return nil, fmt.Errorf("server error: %s", string(responseBytes))
+	}
+}
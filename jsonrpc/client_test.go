@@ -0,0 +1,147 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type clientService struct{}
+
+type DeadlineRequest struct{}
+type DeadlineResponse struct {
+	HasDeadline bool
+	Left        time.Duration
+}
+
+func (*clientService) Deadline(ctx context.Context, req *DeadlineRequest) (*DeadlineResponse, error) {
+	deadline, ok := ctx.Deadline()
+	return &DeadlineResponse{HasDeadline: ok, Left: time.Until(deadline)}, nil
+}
+
+type WaitRequest struct{}
+type WaitResponse struct{}
+
+func (*clientService) Wait(ctx context.Context, req *WaitRequest) (*WaitResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (*clientService) Add(ctx context.Context, req *AddRequest) (*AddResponse, error) {
+	return &AddResponse{Sum: req.A + req.B}, nil
+}
+
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&clientService{}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	client := NewClient(server.URL, WithTransport(transport))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		rsp, err := CallTyped[AddRequest, AddResponse](ctx, client, "Add", &AddRequest{A: i, B: 2})
+		require.NoError(t, err)
+		require.Equal(t, i+2, rsp.Sum)
+	}
+	require.Equal(t, int32(3), transport.calls.Load())
+
+	var rsp DeadlineResponse
+	require.NoError(t, client.Call(ctx, "Deadline", &DeadlineRequest{}, &rsp))
+	require.False(t, rsp.HasDeadline)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&clientService{}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithTimeout(time.Minute))
+
+	var rsp DeadlineResponse
+	require.NoError(t, client.Call(context.Background(), "Deadline", &DeadlineRequest{}, &rsp))
+	require.True(t, rsp.HasDeadline)
+	require.True(t, rsp.Left > 50*time.Second && rsp.Left <= time.Minute, "%v", rsp.Left)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, client.Call(ctx, "Deadline", &DeadlineRequest{}, &rsp))
+	require.True(t, rsp.Left <= 10*time.Second, "%v", rsp.Left)
+
+	// the method stops together with the caller
+	start := time.Now()
+	err := NewClient(server.URL, WithTimeout(100*time.Millisecond)).Call(context.Background(), "Wait", &WaitRequest{}, &WaitResponse{})
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	post, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	post.Header.Set(TimeoutHeader, "soon")
+	httpRsp, err := http.DefaultClient.Do(post)
+	require.NoError(t, err)
+	defer httpRsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, httpRsp.StatusCode)
+}
+
+func TestClient_Retries(t *testing.T) {
+	var failures, calls atomic.Int32
+	handler := MakeHandler(&clientService{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithRetries(3, time.Millisecond), WithIdempotent("Deadline"))
+	ctx := context.Background()
+
+	failures.Store(2)
+	require.NoError(t, client.Call(ctx, "Deadline", &DeadlineRequest{}, &DeadlineResponse{}))
+	require.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	failures.Store(5)
+	require.Error(t, client.Call(ctx, "Deadline", &DeadlineRequest{}, &DeadlineResponse{}))
+	require.Equal(t, int32(4), calls.Load())
+
+	// methods that are not idempotent are sent once
+	calls.Store(0)
+	failures.Store(1)
+	require.Error(t, client.Call(ctx, "Add", &AddRequest{}, &AddResponse{}))
+	require.Equal(t, int32(1), calls.Load())
+
+	// a backoff longer than the deadline gives up early
+	calls.Store(0)
+	failures.Store(5)
+	slow := NewClient(server.URL, WithRetries(3, time.Hour), WithIdempotent("Deadline"), WithTimeout(50*time.Millisecond))
+	require.Error(t, slow.Call(ctx, "Deadline", &DeadlineRequest{}, &DeadlineResponse{}))
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&clientService{}))
+	endpoint := server.URL
+	server.Close()
+
+	transport := &countingTransport{}
+	client := NewClient(endpoint, WithTransport(transport), WithRetries(2, time.Millisecond), WithIdempotent("Add"))
+	require.Error(t, client.Call(context.Background(), "Add", &AddRequest{}, &AddResponse{}))
+	require.Equal(t, int32(3), transport.calls.Load())
+}
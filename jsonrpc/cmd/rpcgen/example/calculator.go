@@ -0,0 +1,62 @@
+//go:build !solution
+
+// Package example shows clients generated by rpcgen.
+package example
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+//go:generate go run gitlab.com/slon/shad-go/jsonrpc/cmd/rpcgen -type Calculator
+//go:generate go run gitlab.com/slon/shad-go/jsonrpc/cmd/rpcgen -type Clock
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+func init() {
+	jsonrpc.RegisterError(ErrDivisionByZero, 1100, 400)
+}
+
+type Calculator struct{}
+
+type DivideRequest struct{ A, B int }
+type DivideResponse struct{ Quotient, Remainder int }
+
+func (*Calculator) Divide(ctx context.Context, req *DivideRequest) (*DivideResponse, error) {
+	if req.B == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return &DivideResponse{Quotient: req.A / req.B, Remainder: req.A % req.B}, nil
+}
+
+type RangeRequest struct{ From, To int }
+type Number struct{ N int }
+
+func (*Calculator) Range(ctx context.Context, req *RangeRequest, stream jsonrpc.Stream[*Number]) error {
+	for n := req.From; n < req.To; n++ {
+		if err := stream.Send(&Number{N: n}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset is not an RPC method, the client does not get it.
+func (*Calculator) Reset() {}
+
+// Clock is implemented by the server and by the generated client.
+type Clock interface {
+	Now(ctx context.Context, req *NowRequest) (*NowResponse, error)
+}
+
+type NowRequest struct {
+	Location string
+}
+
+type NowResponse struct {
+	Time     time.Time
+	Duration time.Duration
+}
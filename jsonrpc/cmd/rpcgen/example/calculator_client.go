@@ -0,0 +1,32 @@
+//go:build !solution
+
+// Code generated by rpcgen -type Calculator; DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"iter"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+// CalculatorClient calls the methods of Calculator over JSON-RPC.
+type CalculatorClient struct {
+	c *jsonrpc.Client
+}
+
+// NewCalculatorClient returns a client calling the methods of Calculator through c.
+func NewCalculatorClient(c *jsonrpc.Client) *CalculatorClient {
+	return &CalculatorClient{c: c}
+}
+
+// Divide calls the method Divide.
+func (c *CalculatorClient) Divide(ctx context.Context, req *DivideRequest) (*DivideResponse, error) {
+	return jsonrpc.CallTyped[DivideRequest, DivideResponse](ctx, c.c, "Divide", req)
+}
+
+// Range calls the streaming method Range and iterates over its items.
+func (c *CalculatorClient) Range(ctx context.Context, req *RangeRequest) iter.Seq2[*Number, error] {
+	return jsonrpc.CallStream[RangeRequest, Number](ctx, c.c, "Range", req)
+}
@@ -0,0 +1,28 @@
+//go:build !solution
+
+// Code generated by rpcgen -type Clock; DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+// ClockClient calls the methods of Clock over JSON-RPC.
+type ClockClient struct {
+	c *jsonrpc.Client
+}
+
+// NewClockClient returns a client calling the methods of Clock through c.
+func NewClockClient(c *jsonrpc.Client) *ClockClient {
+	return &ClockClient{c: c}
+}
+
+// Now calls the method Now.
+func (c *ClockClient) Now(ctx context.Context, req *NowRequest) (*NowResponse, error) {
+	return jsonrpc.CallTyped[NowRequest, NowResponse](ctx, c.c, "Now", req)
+}
+
+var _ Clock = (*ClockClient)(nil)
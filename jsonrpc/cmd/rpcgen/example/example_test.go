@@ -0,0 +1,58 @@
+package example
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+func TestCalculatorClient(t *testing.T) {
+	server := httptest.NewServer(jsonrpc.MakeHandler(&Calculator{}))
+	defer server.Close()
+
+	client := NewCalculatorClient(jsonrpc.NewClient(server.URL))
+	ctx := context.Background()
+
+	rsp, err := client.Divide(ctx, &DivideRequest{A: 7, B: 2})
+	require.NoError(t, err)
+	require.Equal(t, &DivideResponse{Quotient: 3, Remainder: 1}, rsp)
+
+	_, err = client.Divide(ctx, &DivideRequest{A: 1})
+	require.ErrorIs(t, err, ErrDivisionByZero)
+
+	var numbers []int
+	for n, err := range client.Range(ctx, &RangeRequest{From: 1, To: 4}) {
+		require.NoError(t, err)
+		numbers = append(numbers, n.N)
+	}
+	require.Equal(t, []int{1, 2, 3}, numbers)
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now(ctx context.Context, req *NowRequest) (*NowResponse, error) {
+	loc, err := time.LoadLocation(req.Location)
+	if err != nil {
+		return nil, err
+	}
+	return &NowResponse{Time: c.now.In(loc), Duration: time.Minute}, nil
+}
+
+func TestClockClient(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(jsonrpc.MakeHandler(&fixedClock{now: now}))
+	defer server.Close()
+
+	var clock Clock = NewClockClient(jsonrpc.NewClient(server.URL))
+	rsp, err := clock.Now(context.Background(), &NowRequest{Location: "UTC"})
+	require.NoError(t, err)
+	require.True(t, now.Equal(rsp.Time))
+	require.Equal(t, time.Minute, rsp.Duration)
+}
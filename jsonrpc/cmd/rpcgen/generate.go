@@ -0,0 +1,374 @@
+//go:build !solution
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const jsonrpcPath = "gitlab.com/slon/shad-go/jsonrpc"
+
+// service is a type whose RPC methods get a client.
+type service struct {
+	Name string
+	// Implements is set for interfaces whose every method became
+	// a unary method of the client, so the client satisfies them
+	Implements bool
+	Methods    []method
+}
+
+type method struct {
+	Name string
+	// Request and Response are the types pointed to by the parameter and the result,
+	// Response is the item type of streaming methods.
+	Request   string
+	Response  string
+	Streaming bool
+}
+
+// source is a parsed Go file with its imports by name.
+type source struct {
+	file    *ast.File
+	imports map[string]string
+}
+
+type generator struct {
+	fset    *token.FileSet
+	pkgName string
+	files   []*source
+	// imports are the packages the generated code refers to, by name
+	imports map[string]string
+}
+
+// generate returns the client code of the types declared in the package in dir.
+func generate(dir string, typeNames []string) ([]byte, error) {
+	g := &generator{fset: token.NewFileSet(), imports: make(map[string]string)}
+	if err := g.parse(dir); err != nil {
+		return nil, err
+	}
+
+	var services []*service
+	var buildTag string
+	for _, name := range typeNames {
+		s, tag, err := g.service(name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+		if buildTag == "" {
+			buildTag = tag
+		}
+	}
+
+	streaming := false
+	for _, s := range services {
+		for _, m := range s.Methods {
+			streaming = streaming || m.Streaming
+		}
+	}
+	// the standard library goes first, as goimports groups it
+	std := []string{strconv.Quote("context")}
+	if streaming {
+		std = append(std, strconv.Quote("iter"))
+	}
+	other := []string{strconv.Quote(jsonrpcPath)}
+	for name, path := range g.imports {
+		switch {
+		case path == "context" || path == "iter" || path == jsonrpcPath:
+		case !strings.Contains(strings.Split(path, "/")[0], "."):
+			std = append(std, importSpec(name, path))
+		default:
+			other = append(other, importSpec(name, path))
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	imports := append(std, "")
+	imports = append(imports, other...)
+
+	var buf bytes.Buffer
+	err := clientTemplate.Execute(&buf, map[string]any{
+		"BuildTag": buildTag,
+		"Command":  "rpcgen -type " + strings.Join(typeNames, ","),
+		"Package":  g.pkgName,
+		"Imports":  imports,
+		"Services": services,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while executing template: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error while formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+func importSpec(name, path string) string {
+	if name == filepath.Base(path) {
+		return strconv.Quote(path)
+	}
+	return name + " " + strconv.Quote(path)
+}
+
+// parse reads the non-test files of the package in dir.
+func (g *generator) parse(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(g.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		if ast.IsGenerated(f) {
+			continue
+		}
+		if g.pkgName == "" {
+			g.pkgName = f.Name.Name
+		}
+
+		src := &source{file: f, imports: make(map[string]string)}
+		for _, spec := range f.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			name := filepath.Base(path)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			src.imports[name] = path
+		}
+		g.files = append(g.files, src)
+	}
+
+	if g.pkgName == "" {
+		return fmt.Errorf("no go files in %s", dir)
+	}
+	return nil
+}
+
+// service collects the RPC methods of the type. Methods of interfaces are
+// their own, named types have the methods declared on T and *T.
+func (g *generator) service(name string) (*service, string, error) {
+	for _, src := range g.files {
+		for _, decl := range src.file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != name {
+					continue
+				}
+
+				s := &service{Name: name}
+				if it, ok := ts.Type.(*ast.InterfaceType); ok {
+					s.Implements = true
+					for _, field := range it.Methods.List {
+						ft, ok := field.Type.(*ast.FuncType)
+						if !ok {
+							// methods of embedded interfaces are not generated
+							s.Implements = false
+							continue
+						}
+						for _, n := range field.Names {
+							m, ok := g.addMethod(s, src, n.Name, ft)
+							s.Implements = s.Implements && ok && !m.Streaming
+						}
+					}
+				} else {
+					g.collectMethods(s)
+				}
+
+				if len(s.Methods) == 0 {
+					return nil, "", fmt.Errorf("type %s has no RPC methods", name)
+				}
+				sort.Slice(s.Methods, func(i, j int) bool { return s.Methods[i].Name < s.Methods[j].Name })
+				return s, buildTag(src.file), nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("type %s is not declared in package %s", name, g.pkgName)
+}
+
+func (g *generator) collectMethods(s *service) {
+	for _, src := range g.files {
+		for _, decl := range src.file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || len(fd.Recv.List) != 1 {
+				continue
+			}
+
+			recv := fd.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if id, ok := recv.(*ast.Ident); ok && id.Name == s.Name {
+				g.addMethod(s, src, fd.Name.Name, fd.Type)
+			}
+		}
+	}
+}
+
+// addMethod adds the method if it has the signature of an RPC method,
+// others are rejected by jsonrpc.NewService and skipped here.
+func (g *generator) addMethod(s *service, src *source, name string, ft *ast.FuncType) (method, bool) {
+	if !ast.IsExported(name) {
+		return method{}, false
+	}
+
+	params := flatten(ft.Params)
+	results := flatten(ft.Results)
+	if len(params) < 2 || len(params) > 3 || !isSelector(src, params[0], "context", "Context") {
+		return method{}, false
+	}
+	req, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return method{}, false
+	}
+
+	m := method{Name: name, Request: g.typeString(src, req.X)}
+	switch {
+	case len(params) == 2 && len(results) == 2 && isError(results[1]):
+		rsp, ok := results[0].(*ast.StarExpr)
+		if !ok {
+			return method{}, false
+		}
+		m.Response = g.typeString(src, rsp.X)
+	case len(params) == 3 && len(results) == 1 && isError(results[0]):
+		stream, ok := params[2].(*ast.IndexExpr)
+		if !ok || !isSelector(src, stream.X, jsonrpcPath, "Stream") {
+			return method{}, false
+		}
+		item, ok := stream.Index.(*ast.StarExpr)
+		if !ok {
+			return method{}, false
+		}
+		m.Response = g.typeString(src, item.X)
+		m.Streaming = true
+	default:
+		return method{}, false
+	}
+	s.Methods = append(s.Methods, m)
+	return m, true
+}
+
+// flatten lists the type of every parameter, fields may name several.
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, f := range fields.List {
+		for n := max(len(f.Names), 1); n > 0; n-- {
+			types = append(types, f.Type)
+		}
+	}
+	return types
+}
+
+func isSelector(src *source, e ast.Expr, path, name string) bool {
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && src.imports[pkg.Name] == path
+}
+
+func isError(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "error"
+}
+
+// typeString prints a type expression and records the packages it uses.
+func (g *generator) typeString(src *source, e ast.Expr) string {
+	ast.Inspect(e, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				if path, ok := src.imports[pkg.Name]; ok {
+					g.imports[pkg.Name] = path
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return types.ExprString(e)
+}
+
+// buildTag returns the //go:build line of f, the generated file gets the same constraint.
+func buildTag(f *ast.File) string {
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//go:build ") {
+				return c.Text
+			}
+		}
+	}
+	return ""
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`
+{{- with .BuildTag}}{{.}}
+
+{{end -}}
+// Code generated by {{.Command}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+{{with .}}	{{.}}{{end}}
+{{- end}}
+)
+{{range .Services}}{{$client := printf "%sClient" .Name}}
+// {{$client}} calls the methods of {{.Name}} over JSON-RPC.
+type {{$client}} struct {
+	c *jsonrpc.Client
+}
+
+// New{{$client}} returns a client calling the methods of {{.Name}} through c.
+func New{{$client}}(c *jsonrpc.Client) *{{$client}} {
+	return &{{$client}}{c: c}
+}
+{{range .Methods}}
+{{- if .Streaming}}
+// {{.Name}} calls the streaming method {{.Name}} and iterates over its items.
+func (c *{{$client}}) {{.Name}}(ctx context.Context, req *{{.Request}}) iter.Seq2[*{{.Response}}, error] {
+	return jsonrpc.CallStream[{{.Request}}, {{.Response}}](ctx, c.c, "{{.Name}}", req)
+}
+{{else}}
+// {{.Name}} calls the method {{.Name}}.
+func (c *{{$client}}) {{.Name}}(ctx context.Context, req *{{.Request}}) (*{{.Response}}, error) {
+	return jsonrpc.CallTyped[{{.Request}}, {{.Response}}](ctx, c.c, "{{.Name}}", req)
+}
+{{end}}
+{{- end}}
+{{- if .Implements}}
+var _ {{.Name}} = (*{{$client}})(nil)
+{{end}}
+{{- end}}`))
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_Example(t *testing.T) {
+	for _, name := range []string{"Calculator", "Clock"} {
+		src, err := generate("example", []string{name})
+		require.NoError(t, err)
+
+		committed, err := os.ReadFile(filepath.Join("example", strings.ToLower(name)+"_client.go"))
+		require.NoError(t, err)
+		require.Equal(t, string(committed), string(src), "run go generate in example")
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	_, err := generate("example", []string{"Missing"})
+	require.Error(t, err)
+
+	_, err = generate("example", []string{"NowRequest"})
+	require.Error(t, err)
+}
+
+// TestGenerate_PartialInterface compiles the client of interfaces
+// the client can not implement.
+func TestGenerate_PartialInterface(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+
+	// the package lives inside the module to import jsonrpc
+	dir, err := os.MkdirTemp(".", "partial")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	src := `package partial
+
+import (
+	"context"
+
+	"gitlab.com/slon/shad-go/jsonrpc"
+)
+
+type Request struct{}
+
+type Item struct{}
+
+type Unary interface {
+	Get(ctx context.Context, req *Request) (*Item, error)
+}
+
+type Feed interface {
+	Unary
+	Watch(ctx context.Context, req *Request, stream jsonrpc.Stream[*Item]) error
+	Local(n int) int
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partial.go"), []byte(src), 0o644))
+
+	client, err := generate(dir, []string{"Unary", "Feed"})
+	require.NoError(t, err)
+	require.Contains(t, string(client), "var _ Unary = (*UnaryClient)(nil)")
+	require.NotContains(t, string(client), "var _ Feed")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partial_client.go"), client, 0o644))
+
+	out, err := exec.Command("go", "build", "./"+dir).CombinedOutput()
+	require.NoError(t, err, string(out))
+}
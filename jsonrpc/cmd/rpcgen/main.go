@@ -0,0 +1,52 @@
+//go:build !change
+
+// rpcgen generates typed clients of services exposed with jsonrpc.MakeHandler.
+//
+//	//go:generate go run gitlab.com/slon/shad-go/jsonrpc/cmd/rpcgen -type Service
+//
+// For every type it writes a ServiceClient with a method per RPC method of
+// the type. The type is either the struct passed to MakeHandler or an
+// interface listing the methods, the client of an interface implements it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of service types; must be set")
+	output := flag.String("output", "", "output file name; default <type>_client.go")
+	flag.Parse()
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	src, err := generate(dir, types)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpcgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		*output = strings.ToLower(types[0]) + "_client.go"
+	}
+	if !strings.ContainsRune(*output, filepath.Separator) {
+		*output = filepath.Join(dir, *output)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "rpcgen: %v\n", err)
+		os.Exit(1)
+	}
+}
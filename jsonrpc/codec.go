@@ -0,0 +1,164 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Codec encodes the messages of calls. The handler picks the codec by the
+// Content-Type of the request and answers in the codec named by Accept,
+// or in the codec of the request. Clients choose it with WithCodec.
+//
+// The envelopes of requests and responses hold params and results as
+// RawMessage: a codec has to encode it verbatim and decode the encoding
+// of a single value into it.
+type Codec interface {
+	// ContentType is the media type of the encoding.
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// NewDecoder reads values encoded one after another, as streaming methods send them.
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder reads a sequence of values, Decode returns io.EOF after the last one.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Codecs known to every handler.
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+)
+
+// WithCodecs adds codecs to the handler besides JSON and MessagePack.
+// A codec replaces the one with the same content type.
+func WithCodecs(codecs ...Codec) Option {
+	return func(o *options) {
+		o.codecs = append(o.codecs, codecs...)
+	}
+}
+
+// RawMessage is a value already encoded by the codec of the call.
+type RawMessage []byte
+
+// MarshalJSON returns m as the JSON encoding of m.
+func (m RawMessage) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	return m, nil
+}
+
+// UnmarshalJSON sets *m to a copy of data.
+func (m *RawMessage) UnmarshalJSON(data []byte) error {
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// transcode converts a value encoded with in to out. Values that
+// can not be converted become nil.
+func transcode(raw RawMessage, in, out Codec) RawMessage {
+	if raw == nil || in.ContentType() == out.ContentType() {
+		return raw
+	}
+
+	var v any
+	var err error
+	if in.ContentType() == JSON.ContentType() {
+		// keep integers exact
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		err = d.Decode(&v)
+	} else {
+		err = in.Unmarshal(raw, &v)
+	}
+	if err != nil {
+		return nil
+	}
+
+	data, err := out.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// streamContentType is the content type of the streamed responses of c.
+// JSON streams are newline-delimited, other codecs write values back to back.
+func streamContentType(c Codec) string {
+	if c.ContentType() == JSON.ContentType() {
+		return StreamContentType
+	}
+	return c.ContentType()
+}
+
+// hasContentType reports whether the Content-Type header names the media type.
+func hasContentType(h http.Header, mediaType string) bool {
+	t, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && t == mediaType
+}
+
+// codecs are the codecs of a handler by media type.
+type codecs map[string]Codec
+
+func newCodecs(extra []Codec) codecs {
+	cs := codecs{}
+	for _, c := range append([]Codec{JSON, MessagePack}, extra...) {
+		cs[c.ContentType()] = c
+	}
+	return cs
+}
+
+// negotiate picks the codecs of the request and of the response.
+// Requests without Content-Type are JSON, ok is false for unknown types.
+func (cs codecs) negotiate(r *http.Request) (in, out Codec, ok bool) {
+	in = JSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		t, _, err := mime.ParseMediaType(contentType)
+		if in, ok = cs[t]; err != nil || !ok {
+			return nil, nil, false
+		}
+	}
+
+	out = in
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		if t == in.ContentType() || t == streamContentType(in) {
+			break
+		}
+		if c, ok := cs[t]; ok {
+			out = c
+			break
+		}
+	}
+	return in, out, true
+}
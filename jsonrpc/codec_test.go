@@ -0,0 +1,310 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Base struct {
+	ID   int64  `json:"id"`
+	Note string `json:"note,omitempty"`
+}
+
+type Record struct {
+	Base
+	Name    string            `json:"name"`
+	Small   int8              `json:"small"`
+	Big     uint64            `json:"big"`
+	Neg     int64             `json:"neg"`
+	Ratio   float64           `json:"ratio"`
+	Half    float32           `json:"half"`
+	OK      bool              `json:"ok"`
+	Blob    []byte            `json:"blob"`
+	Tags    map[string]string `json:"tags"`
+	Counts  map[int]int       `json:"counts"`
+	List    []Point           `json:"list"`
+	Pair    [2]int            `json:"pair"`
+	Parent  *Record           `json:"parent,omitempty"`
+	Created time.Time         `json:"created"`
+	Extra   json.RawMessage   `json:"extra"`
+	Any     any               `json:"any"`
+	Skipped int               `json:"-"`
+	hidden  int
+}
+
+func TestMessagePack(t *testing.T) {
+	r := Record{
+		Base:    Base{ID: 7},
+		Name:    strings.Repeat("x", 300),
+		Small:   -100,
+		Big:     math.MaxUint64,
+		Neg:     math.MinInt64,
+		Ratio:   1.5,
+		Half:    0.25,
+		OK:      true,
+		Blob:    []byte{0, 1, 2},
+		Tags:    map[string]string{"a": "b"},
+		Counts:  map[int]int{-1: 70000},
+		List:    []Point{{X: 1, Y: 2}},
+		Pair:    [2]int{3, 4},
+		Parent:  &Record{Name: "parent", Extra: json.RawMessage("null")},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Extra:   json.RawMessage(`{"k":[1,2.5,"s",null,true]}`),
+		Any:     map[string]any{"n": int64(-3)},
+		Skipped: 1,
+		hidden:  2,
+	}
+
+	data, err := MessagePack.Marshal(&r)
+	require.NoError(t, err)
+
+	var decoded Record
+	require.NoError(t, MessagePack.Unmarshal(data, &decoded))
+
+	r.Skipped, r.hidden = 0, 0
+	require.JSONEq(t, string(r.Extra), string(decoded.Extra))
+	decoded.Extra = r.Extra
+	require.Equal(t, r, decoded)
+
+	var generic map[string]any
+	require.NoError(t, MessagePack.Unmarshal(data, &generic))
+	require.Equal(t, int64(7), generic["id"])
+	require.NotContains(t, generic, "note")
+	require.NotContains(t, generic, "Skipped")
+}
+
+func TestMessagePack_Format(t *testing.T) {
+	for _, tc := range []struct {
+		value any
+		data  []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{1, []byte{0x01}},
+		{-1, []byte{0xff}},
+		{200, []byte{0xcc, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{"abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{[]byte{1}, []byte{0xc4, 0x01, 0x01}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{struct{ A int }{A: 1}, []byte{0x81, 0xa1, 'A', 0x01}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+	} {
+		data, err := MessagePack.Marshal(tc.value)
+		require.NoError(t, err)
+		require.Equal(t, tc.data, data, "%v", tc.value)
+	}
+
+	var n int8
+	require.Error(t, MessagePack.Unmarshal([]byte{0xcc, 0xc8}, &n))
+	var u uint
+	require.Error(t, MessagePack.Unmarshal([]byte{0xff}, &u))
+	var s string
+	require.Error(t, MessagePack.Unmarshal([]byte{0x01}, &s))
+	require.Error(t, MessagePack.Unmarshal([]byte{0xa3, 'a'}, &s))
+	require.Error(t, MessagePack.Unmarshal([]byte{0xa1, 'a', 0x01}, &s))
+	require.Error(t, MessagePack.Unmarshal([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &[]int{}))
+}
+
+func TestMessagePack_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		data, err := MessagePack.Marshal(&CountItem{I: i})
+		require.NoError(t, err)
+		buf.Write(data)
+	}
+
+	d := MessagePack.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for i := 0; i < 3; i++ {
+		var item CountItem
+		require.NoError(t, d.Decode(&item))
+		require.Equal(t, i, item.I)
+	}
+	require.Equal(t, io.EOF, d.Decode(&CountItem{}))
+
+	d = MessagePack.NewDecoder(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NoError(t, d.Decode(&CountItem{}))
+	require.NoError(t, d.Decode(&CountItem{}))
+	require.ErrorIs(t, d.Decode(&CountItem{}), io.ErrUnexpectedEOF)
+}
+
+func TestCodecs(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&testService{}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCodec(MessagePack))
+	ctx := context.Background()
+
+	rsp, err := CallTyped[AddRequest, AddResponse](ctx, client, "Add", &AddRequest{A: 1, B: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, rsp.Sum)
+
+	err = client.Call(ctx, "Lookup", &LookupRequest{User: "greedy"}, &LookupResponse{})
+	var quotaErr *QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, 10, quotaErr.Limit)
+
+	err = client.Call(ctx, "Lookup", &LookupRequest{User: "custom"}, &LookupResponse{})
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.JSONEq(t, `{"reason":"test"}`, string(rpcErr.Data))
+
+	require.NoError(t, client.Notify(ctx, "Notify", &NotifyRequest{}))
+
+	var schema map[string]any
+	require.NoError(t, client.Call(ctx, DiscoverMethod, nil, &schema))
+	require.Equal(t, "1.2.6", schema["openrpc"])
+}
+
+func TestCodecs_Stream(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&streamService{}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCodec(MessagePack))
+	items, err := collect(t, client, &CountRequest{N: 3})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2}, items)
+
+	items, err = collect(t, client, &CountRequest{N: 5, FailAt: 2})
+	require.Equal(t, []int{0, 1}, items)
+	var quotaErr *QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+}
+
+type testCodec struct {
+	jsonCodec
+}
+
+func (testCodec) ContentType() string {
+	return "application/x-test"
+}
+
+func TestCodecs_Negotiation(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&testService{}, WithCodecs(testCodec{})))
+	defer server.Close()
+
+	post := func(contentType, accept, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { rsp.Body.Close() })
+		return rsp
+	}
+
+	rsp := post("text/plain", "", `{}`)
+	require.Equal(t, http.StatusUnsupportedMediaType, rsp.StatusCode)
+
+	rsp = post("application/json; charset=utf-8", "application/msgpack", `{"jsonrpc": "2.0", "method": "Add", "params": {"A": 1, "B": 2}, "id": 300}`)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/msgpack", rsp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+
+	var decoded response
+	require.NoError(t, MessagePack.Unmarshal(body, &decoded))
+	var id int
+	require.NoError(t, MessagePack.Unmarshal(decoded.ID, &id))
+	require.Equal(t, 300, id)
+	var sum AddResponse
+	require.NoError(t, MessagePack.Unmarshal(decoded.Result, &sum))
+	require.Equal(t, 3, sum.Sum)
+
+	rsp = post("application/x-test", "", `{"jsonrpc": "2.0", "method": "Add", "params": {"A": 1, "B": 2}, "id": 1}`)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/x-test", rsp.Header.Get("Content-Type"))
+
+	client := NewClient(server.URL, WithCodec(testCodec{}))
+	require.NoError(t, client.Call(context.Background(), "Add", &AddRequest{A: 2, B: 2}, &sum))
+	require.Equal(t, 4, sum.Sum)
+}
+
+func TestMessagePack_Depth(t *testing.T) {
+	nested := func(depth int) []byte {
+		data := bytes.Repeat([]byte{0x91}, depth)
+		return append(data, 0xc0)
+	}
+
+	var v any
+	require.NoError(t, MessagePack.Unmarshal(nested(1000), &v))
+	require.ErrorIs(t, MessagePack.Unmarshal(nested(100000), &v), errMsgpackDepth)
+	require.ErrorIs(t, MessagePack.Unmarshal(nested(100000), &RawMessage{}), errMsgpackDepth)
+	require.ErrorIs(t, MessagePack.Unmarshal(nested(100000), &json.RawMessage{}), errMsgpackDepth)
+	require.ErrorIs(t, MessagePack.NewDecoder(bytes.NewReader(nested(100000))).Decode(&v), errMsgpackDepth)
+}
+
+func TestMessagePack_Lengths(t *testing.T) {
+	// the length of an array is only a claim, the elements are invalid
+	const n = 1 << 20
+	data := append([]byte{0xdd, 0x00, 0x10, 0x00, 0x00}, bytes.Repeat([]byte{0xc1}, n)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var items []struct{ Data [1024]byte }
+	require.Error(t, MessagePack.Unmarshal(data, &items))
+	var v any
+	require.Error(t, MessagePack.Unmarshal(data, &v))
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+
+	// the stream decoder does not trust lengths either
+	huge := []byte{0xc6, 0xff, 0xff, 0xff, 0xff}
+	require.ErrorIs(t, MessagePack.NewDecoder(bytes.NewReader(huge)).Decode(&v), errMsgpackSize)
+
+	var decoded [][]int
+	require.NoError(t, MessagePack.Unmarshal(mustMarshal(t, [][]int{{1, 2}, nil, {3}}), &decoded))
+	require.Equal(t, [][]int{{1, 2}, nil, {3}}, decoded)
+
+	// long arrays grow past the preallocated elements
+	long := make([]map[string]int, 3*maxMsgpackPrealloc)
+	for i := range long {
+		long[i] = map[string]int{"i": i}
+	}
+	var decodedLong []map[string]int
+	require.NoError(t, MessagePack.Unmarshal(mustMarshal(t, long), &decodedLong))
+	require.Equal(t, long, decodedLong)
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	data, err := MessagePack.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
+func TestCodecs_Limits(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&testService{}, WithMaxBodySize(1<<20)))
+	defer server.Close()
+
+	post := func(body []byte) *http.Response {
+		rsp, err := http.Post(server.URL, "application/msgpack", bytes.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { rsp.Body.Close() })
+		return rsp
+	}
+
+	// the parse error of a deeply nested request is a response, not a crash
+	deep := append(bytes.Repeat([]byte{0x91}, 500000), 0xc0)
+	rsp := post(deep)
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	var decoded response
+	require.NoError(t, MessagePack.Unmarshal(body, &decoded))
+	require.Equal(t, CodeParseError, decoded.Error.Code)
+
+	rsp = post(append(bytes.Repeat([]byte{0x91}, 2<<20), 0xc0))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rsp.StatusCode)
+}
@@ -0,0 +1,157 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// Errors standing for the error codes of the JSON-RPC 2.0 specification.
+// Methods may return them, errors.Is matches them on the client.
+var (
+	ErrParse          = errors.New("parse error")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrMethodNotFound = errors.New("method not found")
+	ErrInvalidParams  = errors.New("invalid params")
+	ErrInternal       = errors.New("internal error")
+)
+
+// Codes from minReservedCode to maxReservedCode are reserved by the specification.
+const (
+	minReservedCode = -32768
+	maxReservedCode = -32000
+)
+
+// registeredError is an error that travels with its own code.
+// Either err is a sentinel value or typ is an error type.
+type registeredError struct {
+	code   int
+	status int
+	err    error
+	typ    reflect.Type
+}
+
+var registry = struct {
+	sync.RWMutex
+	errors []*registeredError
+	byCode map[int]*registeredError
+}{
+	byCode: make(map[int]*registeredError),
+}
+
+func init() {
+	register(&registeredError{code: CodeParseError, status: http.StatusBadRequest, err: ErrParse})
+	register(&registeredError{code: CodeInvalidRequest, status: http.StatusBadRequest, err: ErrInvalidRequest})
+	register(&registeredError{code: CodeMethodNotFound, status: http.StatusNotFound, err: ErrMethodNotFound})
+	register(&registeredError{code: CodeInvalidParams, status: http.StatusBadRequest, err: ErrInvalidParams})
+	register(&registeredError{code: CodeInternalError, status: http.StatusInternalServerError, err: ErrInternal})
+}
+
+func register(r *registeredError) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.byCode[r.code]; ok {
+		panic(fmt.Sprintf("jsonrpc: error code %d registered twice", r.code))
+	}
+	registry.errors = append(registry.errors, r)
+	registry.byCode[r.code] = r
+}
+
+func checkCode(code int) {
+	if code >= minReservedCode && code <= maxReservedCode {
+		panic(fmt.Sprintf("jsonrpc: error code %d is reserved", code))
+	}
+}
+
+// RegisterError makes methods returning an error matching err with errors.Is
+// respond with code, and single requests failing with it get status.
+// Call returns an error matching err for responses with code.
+// Both the server and the client have to register the error.
+func RegisterError(err error, code int, status int) {
+	checkCode(code)
+	register(&registeredError{code: code, status: status, err: err})
+}
+
+// RegisterErrorType is like RegisterError for errors of type E. The error
+// is sent as the data of the error object, Call decodes it into a new E,
+// so that errors.As finds it.
+func RegisterErrorType[E error](code int, status int) {
+	checkCode(code)
+	register(&registeredError{code: code, status: status, typ: reflect.TypeOf((*E)(nil)).Elem()})
+}
+
+// HTTPStatus returns the status of single requests failing with code.
+// Unknown codes are internal server errors.
+func HTTPStatus(code int) int {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if r, ok := registry.byCode[code]; ok {
+		return r.status
+	}
+	return http.StatusInternalServerError
+}
+
+// toError converts an error returned by a method to an error object.
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, r := range registry.errors {
+		if r.err != nil {
+			if errors.Is(err, r.err) {
+				return &Error{Code: r.code, Message: err.Error()}
+			}
+			continue
+		}
+
+		target := reflect.New(r.typ)
+		if errors.As(err, target.Interface()) {
+			data, dataErr := json.Marshal(target.Elem().Interface())
+			if dataErr != nil {
+				return &Error{Code: CodeInternalError, Message: "error while encoding error data: " + dataErr.Error()}
+			}
+			return &Error{Code: r.code, Message: err.Error(), Data: data}
+		}
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+// resolve links e to the registered error of its code.
+func (e *Error) resolve() {
+	registry.RLock()
+	r, ok := registry.byCode[e.Code]
+	registry.RUnlock()
+	if !ok {
+		return
+	}
+	if r.err != nil {
+		e.err = r.err
+		return
+	}
+
+	if r.typ.Kind() == reflect.Ptr {
+		v := reflect.New(r.typ.Elem())
+		if len(e.Data) > 0 {
+			_ = json.Unmarshal(e.Data, v.Interface())
+		}
+		e.err = v.Interface().(error)
+		return
+	}
+	v := reflect.New(r.typ)
+	if len(e.Data) > 0 {
+		_ = json.Unmarshal(e.Data, v.Interface())
+	}
+	e.err = v.Elem().Interface().(error)
+}
@@ -0,0 +1,95 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Handler runs a method with a decoded request, req is *Request
+// and the result is *Response of the method.
+type Handler func(ctx context.Context, req any) (any, error)
+
+// Interceptor wraps every call of a method. It may inspect or replace
+// the request and the response, or return an error without calling next.
+type Interceptor func(ctx context.Context, method string, req any, next Handler) (any, error)
+
+// Option configures the handler of a service.
+type Option func(*options)
+
+type options struct {
+	interceptors []Interceptor
+	codecs       []Codec
+	maxBodySize  int64
+	maxBatch     int
+	batchWorkers int
+}
+
+// WithInterceptors adds interceptors to the handler. They run in the order
+// of registration, the first one is the outermost.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// DefaultMaxBodySize is the limit of request bodies unless WithMaxBodySize is given.
+const DefaultMaxBodySize = 10 << 20
+
+// WithMaxBodySize limits the size of request bodies, larger requests get 413.
+func WithMaxBodySize(n int64) Option {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// DefaultMaxBatchSize is the limit of requests in a batch unless WithMaxBatchSize is given.
+const DefaultMaxBatchSize = 1000
+
+// WithMaxBatchSize limits the number of requests in a batch,
+// larger batches fail with CodeInvalidRequest.
+func WithMaxBatchSize(n int) Option {
+	return func(o *options) {
+		o.maxBatch = n
+	}
+}
+
+// WithBatchConcurrency limits the number of requests of a batch running
+// at once, by default it is GOMAXPROCS.
+func WithBatchConcurrency(n int) Option {
+	return func(o *options) {
+		o.batchWorkers = n
+	}
+}
+
+// chain wraps h into the interceptors. A panic in the method or in
+// an interceptor becomes an internal error, interceptors see panics
+// of the method as errors.
+func chain(name string, h Handler, interceptors []Interceptor) Handler {
+	h = recovering(name, h)
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, name, req, next)
+		}
+	}
+	if len(interceptors) != 0 {
+		h = recovering(name, h)
+	}
+	return h
+}
+
+func recovering(name string, h Handler) Handler {
+	return func(ctx context.Context, req any) (rsp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("jsonrpc: panic in method %s: %v\n%s", name, r, debug.Stack())
+				rsp, err = nil, &Error{Code: CodeInternalError, Message: fmt.Sprintf("panic in method %s: %v", name, r)}
+			}
+		}()
+		return h(ctx, req)
+	}
+}
@@ -0,0 +1,127 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type panicService struct{}
+
+func (*panicService) Panic(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+	panic("boom")
+}
+
+func (*panicService) Add(ctx context.Context, req *AddRequest) (*AddResponse, error) {
+	return &AddResponse{Sum: req.A + req.B}, nil
+}
+
+type tokenKey struct{}
+
+var errUnauthenticated = errors.New("unauthenticated")
+
+func init() {
+	RegisterError(errUnauthenticated, 1003, http.StatusUnauthorized)
+}
+
+func TestInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, method string, req any, next Handler) (any, error) {
+			mu.Lock()
+			trace = append(trace, name+" "+method)
+			mu.Unlock()
+			return next(ctx, req)
+		}
+	}
+
+	double := func(ctx context.Context, method string, req any, next Handler) (any, error) {
+		if add, ok := req.(*AddRequest); ok {
+			add.A *= 2
+		}
+		rsp, err := next(ctx, req)
+		if add, ok := rsp.(*AddResponse); ok {
+			add.Sum++
+		}
+		return rsp, err
+	}
+
+	handler := MakeHandler(&panicService{}, WithInterceptors(record("first"), record("second")), WithInterceptors(double))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx := context.Background()
+	var rsp AddResponse
+	require.NoError(t, Call(ctx, server.URL, "Add", &AddRequest{A: 1, B: 2}, &rsp))
+	require.Equal(t, 5, rsp.Sum)
+	require.Equal(t, []string{"first Add", "second Add"}, trace)
+
+	// the legacy endpoint goes through the interceptors too
+	httpRsp, err := http.Post(server.URL+"/Add", "application/json", strings.NewReader(`{"A": 2, "B": 1}`))
+	require.NoError(t, err)
+	defer httpRsp.Body.Close()
+	require.Equal(t, http.StatusOK, httpRsp.StatusCode)
+	require.Len(t, trace, 4)
+}
+
+func TestInterceptors_Reject(t *testing.T) {
+	auth := func(ctx context.Context, method string, req any, next Handler) (any, error) {
+		if ctx.Value(tokenKey{}) == nil {
+			return nil, errUnauthenticated
+		}
+		return next(ctx, req)
+	}
+
+	server := httptest.NewServer(MakeHandler(&panicService{}, WithInterceptors(auth)))
+	defer server.Close()
+
+	err := Call(context.Background(), server.URL, "Add", &AddRequest{}, &AddResponse{})
+	require.ErrorIs(t, err, errUnauthenticated)
+}
+
+func TestInterceptors_Panic(t *testing.T) {
+	var seen error
+	observe := func(ctx context.Context, method string, req any, next Handler) (any, error) {
+		rsp, err := next(ctx, req)
+		seen = err
+		return rsp, err
+	}
+
+	server := httptest.NewServer(MakeHandler(&panicService{}, WithInterceptors(observe)))
+	defer server.Close()
+
+	ctx := context.Background()
+	err := Call(ctx, server.URL, "Panic", &PingRequest{}, &PingResponse{})
+	require.ErrorIs(t, err, ErrInternal)
+	require.ErrorContains(t, err, "boom")
+	require.Error(t, seen)
+
+	// the server keeps working
+	var rsp AddResponse
+	require.NoError(t, Call(ctx, server.URL, "Add", &AddRequest{A: 1, B: 2}, &rsp))
+	require.Equal(t, 3, rsp.Sum)
+
+	httpRsp, err := http.Post(server.URL+"/Panic", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	defer httpRsp.Body.Close()
+	require.Equal(t, http.StatusInternalServerError, httpRsp.StatusCode)
+}
+
+func TestInterceptors_PanicInInterceptor(t *testing.T) {
+	broken := func(ctx context.Context, method string, req any, next Handler) (any, error) {
+		panic("broken interceptor")
+	}
+
+	server := httptest.NewServer(MakeHandler(&panicService{}, WithInterceptors(broken)))
+	defer server.Close()
+
+	err := Call(context.Background(), server.URL, "Add", &AddRequest{}, &AddResponse{})
+	require.ErrorIs(t, err, ErrInternal)
+}
@@ -3,115 +3,289 @@
 package jsonrpc
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
-func MakeHandler(obj interface{}) http.Handler {
-	mux := http.NewServeMux()
-	objT := reflect.TypeOf(obj)
-	for i := 0; i < objT.NumMethod(); i++ {
-		m := objT.Method(i)
-		err := registerHandlerFunc(obj, m, mux)
-		if err != nil {
-			continue
-		}
+// MakeHandler exposes the methods of obj over http, see Service.Handler.
+func MakeHandler(obj interface{}, opts ...Option) http.Handler {
+	return NewService(obj).Handler(opts...)
+}
+
+// method is an RPC method of a service.
+type method struct {
+	obj       reflect.Value
+	f         reflect.Value
+	inputType reflect.Type
+	// streamType is the Stream[T] parameter of streaming methods
+	streamType reflect.Type
+}
+
+// decode unmarshals params into a new request value,
+// omitted params leave it zero.
+func (m *method) decode(c Codec, params []byte) (reflect.Value, error) {
+	inValue := reflect.New(m.inputType)
+	if len(params) == 0 {
+		return inValue, nil
 	}
-	return mux
+	return inValue, c.Unmarshal(params, inValue.Interface())
 }
 
-func registerHandlerFunc(obj interface{}, m reflect.Method, mux *http.ServeMux) error {
-	mn := m.Name
-	f := m.Func
-	mt := m.Type
-	inputType, err := methodInputType(mt)
-	if err != nil {
-		return fmt.Errorf("while register %v method: %w", mn, err)
+func (m *method) call(ctx context.Context, req any) (any, error) {
+	in := []reflect.Value{m.obj, reflect.ValueOf(ctx), reflect.ValueOf(req)}
+	if m.streamType != nil {
+		sw, ok := ctx.Value(streamKey{}).(*streamWriter)
+		if !ok {
+			return nil, fmt.Errorf("%w: streaming method must be called alone", ErrInvalidRequest)
+		}
+		in = append(in, reflect.ValueOf(rawStream{w: sw}).Convert(m.streamType))
+		if errV := m.f.Call(in)[0]; !errV.IsNil() {
+			return nil, errV.Interface().(error)
+		}
+		return nil, nil
 	}
 
-	mux.Handle("/"+mn, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		bytes, err := io.ReadAll(r.Body)
-		defer r.Body.Close()
+	outValues := m.f.Call(in)
+	if errV := outValues[1]; !errV.IsNil() {
+		return nil, errV.Interface().(error)
+	}
+	return outValues[0].Interface(), nil
+}
 
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+// serveMethod serves the method at /<MethodName>, errors are sent as plain text.
+func (s *server) serveMethod(name string) http.HandlerFunc {
+	m, h := s.methods[name], s.handlers[name]
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, out, ok := s.codecs.negotiate(r)
+		if !ok {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
 			return
 		}
 
-		inValue := reflect.New(inputType)
-		in := inValue.Interface()
-		err = json.Unmarshal(bytes, in)
+		bytes, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
 
+		inValue, err := m.decode(in, bytes)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(err.Error()))
 			return
 		}
-		ctx := r.Context()
-		inValues := []reflect.Value{reflect.ValueOf(obj), reflect.ValueOf(ctx), inValue}
-		outValues := f.Call(inValues)
-		out := outValues[0]
-		errV := outValues[1]
-		if !errV.IsNil() {
-			err = errV.Interface().(error)
-			w.WriteHeader(http.StatusInternalServerError)
+
+		rsp, err := h(r.Context(), inValue.Interface())
+		if err != nil {
+			w.WriteHeader(HTTPStatus(toError(err).Code))
 			w.Write([]byte(err.Error()))
 			return
 		}
 
-		outBytes, _ := json.Marshal(out.Interface())
+		outBytes, _ := out.Marshal(rsp)
+		w.Header().Set("Content-Type", out.ContentType())
 		w.WriteHeader(http.StatusOK)
 		w.Write(outBytes)
-	}))
-	return nil
+	}
+}
+
+// server is the JSON-RPC 2.0 endpoint of a service.
+type server struct {
+	methods  map[string]*method
+	handlers map[string]Handler
+	codecs   codecs
+	schema   json.RawMessage
+	// maxBodySize limits request bodies, zero means DefaultMaxBodySize
+	maxBodySize int64
+	// maxBatch and batchWorkers limit batches, zero means
+	// DefaultMaxBatchSize and GOMAXPROCS
+	maxBatch     int
+	batchWorkers int
 }
 
-func methodInputType(mt reflect.Type) (inType reflect.Type, err error) {
-	numIns := mt.NumIn()
-	if numIns < 3 {
-		return (reflect.Type)(nil), fmt.Errorf("not enough input arguments")
+// readBody reads the request body up to the limit, on failure
+// it writes the error and returns false.
+func (s *server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	limit := s.maxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
 	}
-	paramType := mt.In(2)
-	if paramType.Kind() != reflect.Ptr {
-		return (reflect.Type)(nil), fmt.Errorf("third parameter must be a pointer")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	r.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
 	}
-	return paramType.Elem(), nil
+	return body, true
 }
 
-func Call(ctx context.Context, endpoint string, method string, req, rsp interface{}) error {
-	client := &http.Client{}
-	requestURL := fmt.Sprintf("%s/%s", endpoint, method)
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(req)
-	if err != nil {
-		return fmt.Errorf("error while encoding input struct: %w", err)
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	in, out, ok := s.codecs.negotiate(r)
+	if !ok {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
 	}
 
-	post, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, &buf)
-	if err != nil {
-		return fmt.Errorf("error while creating request: %w", err)
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
 	}
 
-	response, err := client.Do(post)
-	if err != nil {
-		return fmt.Errorf("error while making request from client: %w", err)
+	// a request sent alone gets the status of its error,
+	// a batch may mix errors and results so it always gets 200
+	var result interface{}
+	status := http.StatusOK
+	var raw RawMessage
+	var batch []RawMessage
+	switch {
+	case in.Unmarshal(body, &raw) != nil:
+		rsp := newErrorResponse(nil, CodeParseError, "parse error")
+		result, status = rsp, rsp.status()
+	case in.Unmarshal(body, &batch) == nil:
+		result = s.serveBatch(r.Context(), in, out, batch)
+		if rsp, ok := result.(*response); ok {
+			status = rsp.status()
+		}
+	default:
+		var req request
+		if in.Unmarshal(body, &req) == nil && req.JSONRPC == Version && !req.isNotification() {
+			if m, ok := s.methods[req.Method]; ok && m.streamType != nil {
+				req.ID = transcode(req.ID, in, out)
+				s.serveStream(w, r, in, out, &req)
+				return
+			}
+		}
+		rsp := s.serveRequest(r.Context(), in, out, body)
+		result = rsp
+		if rsp != nil {
+			status = rsp.status()
+		}
 	}
 
-	defer response.Body.Close()
-	responseBytes, err := io.ReadAll(response.Body)
+	// nothing is sent back for notifications
+	if rsp, ok := result.(*response); ok && rsp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if rsps, ok := result.([]*response); ok && len(rsps) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	outBytes, _ := out.Marshal(result)
+	w.Header().Set("Content-Type", out.ContentType())
+	w.WriteHeader(status)
+	w.Write(outBytes)
+}
+
+// serveBatch runs the requests of a batch concurrently.
+// The responses keep the order of the requests, notifications are skipped.
+func (s *server) serveBatch(ctx context.Context, in, out Codec, batch []RawMessage) interface{} {
+	maxBatch := s.maxBatch
+	if maxBatch <= 0 {
+		maxBatch = DefaultMaxBatchSize
+	}
+	if len(batch) == 0 {
+		return newErrorResponse(nil, CodeInvalidRequest, "invalid request")
+	}
+	if len(batch) > maxBatch {
+		return newErrorResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch of %d requests exceeds %d", len(batch), maxBatch))
+	}
+
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// workers take the requests in order until none is left
+	rsps := make([]*response, len(batch))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range min(workers, len(batch)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(batch); i = int(next.Add(1) - 1) {
+				rsps[i] = s.serveRequest(ctx, in, out, batch[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	answered := make([]*response, 0, len(rsps))
+	for _, rsp := range rsps {
+		if rsp != nil {
+			answered = append(answered, rsp)
+		}
+	}
+	return answered
+}
+
+// serveRequest runs a single request, it returns nil for notifications.
+func (s *server) serveRequest(ctx context.Context, in, out Codec, raw []byte) *response {
+	var req request
+	if err := in.Unmarshal(raw, &req); err != nil {
+		return newErrorResponse(nil, CodeInvalidRequest, "invalid request")
+	}
+	req.ID = transcode(req.ID, in, out)
+	if req.JSONRPC != Version || req.Method == "" {
+		return newErrorResponse(req.ID, CodeInvalidRequest, "invalid request")
+	}
+
+	rsp := s.call(ctx, in, out, &req)
+	if req.isNotification() {
+		return nil
+	}
+	return rsp
+}
+
+// call runs the method of req, its params are encoded with in
+// and the result is encoded with out.
+func (s *server) call(ctx context.Context, in, out Codec, req *request) *response {
+	if req.Method == DiscoverMethod {
+		return s.discover(out, req.ID)
+	}
+
+	m, ok := s.methods[req.Method]
+	if !ok {
+		return newErrorResponse(req.ID, CodeMethodNotFound, "method not found: "+req.Method)
+	}
+
+	inValue, err := m.decode(in, req.Params)
 	if err != nil {
-		return fmt.Errorf("error while reading response body: %w", err)
+		return newErrorResponse(req.ID, CodeInvalidParams, "invalid params: "+err.Error())
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("server error: %s", string(responseBytes))
+	rsp, err := s.handlers[req.Method](ctx, inValue.Interface())
+	if err != nil {
+		return &response{JSONRPC: Version, Error: toError(err), ID: req.ID}
 	}
 
-	return json.Unmarshal(responseBytes, &rsp)
+	result, err := out.Marshal(rsp)
+	if err != nil {
+		return newErrorResponse(req.ID, CodeInternalError, "error while encoding result: "+err.Error())
+	}
+	return &response{JSONRPC: Version, Result: result, ID: req.ID}
 }
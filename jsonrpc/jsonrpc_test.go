@@ -2,14 +2,24 @@ package jsonrpc
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-type testService struct{}
+type testService struct {
+	notified atomic.Int32
+}
 
 type PingRequest struct{}
 type PingResponse struct{}
@@ -32,6 +42,43 @@ func (*testService) Error(ctx context.Context, req *ErrorRequest) (*ErrorRespons
 	return nil, fmt.Errorf("cache is empty")
 }
 
+type NotifyRequest struct{}
+type NotifyResponse struct{}
+
+func (s *testService) Notify(ctx context.Context, req *NotifyRequest) (*NotifyResponse, error) {
+	s.notified.Add(1)
+	return &NotifyResponse{}, nil
+}
+
+var ErrNoSuchUser = errors.New("no such user")
+
+type QuotaError struct{ Limit int }
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota of %d calls exceeded", e.Limit)
+}
+
+func init() {
+	RegisterError(ErrNoSuchUser, 1001, http.StatusNotFound)
+	RegisterErrorType[*QuotaError](1002, http.StatusTooManyRequests)
+}
+
+type LookupRequest struct{ User string }
+type LookupResponse struct{}
+
+func (*testService) Lookup(ctx context.Context, req *LookupRequest) (*LookupResponse, error) {
+	switch req.User {
+	case "":
+		return nil, fmt.Errorf("empty user: %w", ErrInvalidParams)
+	case "greedy":
+		return nil, fmt.Errorf("lookup: %w", &QuotaError{Limit: 10})
+	case "custom":
+		return nil, &Error{Code: 42, Message: "custom", Data: json.RawMessage(`{"reason":"test"}`)}
+	default:
+		return nil, fmt.Errorf("user %q: %w", req.User, ErrNoSuchUser)
+	}
+}
+
 func TestJSONRPC(t *testing.T) {
 	server := httptest.NewServer(MakeHandler(&testService{}))
 	defer server.Close()
@@ -68,3 +115,367 @@ func TestJSONRPC(t *testing.T) {
 		require.Contains(t, err.Error(), "cache is empty")
 	})
 }
+
+func TestJSONRPC_Notify(t *testing.T) {
+	service := &testService{}
+	server := httptest.NewServer(MakeHandler(service))
+	defer server.Close()
+
+	require.NoError(t, Notify(context.Background(), server.URL, "Notify", &NotifyRequest{}))
+	require.Equal(t, int32(1), service.notified.Load())
+}
+
+func TestJSONRPC_Legacy(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&testService{}))
+	defer server.Close()
+
+	rsp, err := http.Post(server.URL+"/Add", "application/json", strings.NewReader(`{"A": 1, "B": 2}`))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.JSONEq(t, `{"Sum": 3}`, string(body))
+}
+
+func TestJSONRPC_Protocol(t *testing.T) {
+	service := &testService{}
+	server := httptest.NewServer(MakeHandler(service))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name     string
+		request  string
+		status   int
+		response string
+	}{
+		{
+			name:     "call",
+			request:  `{"jsonrpc": "2.0", "method": "Add", "params": {"A": 1, "B": 2}, "id": 1}`,
+			status:   http.StatusOK,
+			response: `{"jsonrpc": "2.0", "result": {"Sum": 3}, "id": 1}`,
+		},
+		{
+			name:     "string id",
+			request:  `{"jsonrpc": "2.0", "method": "Ping", "id": "abc"}`,
+			status:   http.StatusOK,
+			response: `{"jsonrpc": "2.0", "result": {}, "id": "abc"}`,
+		},
+		{
+			name:     "parse error",
+			request:  `{"jsonrpc": "2.0", "method": "Add", "params": {`,
+			status:   http.StatusBadRequest,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32700, "message": "parse error"}, "id": null}`,
+		},
+		{
+			name:     "invalid request",
+			request:  `{"jsonrpc": "1.0", "method": "Add", "id": 1}`,
+			status:   http.StatusBadRequest,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "invalid request"}, "id": 1}`,
+		},
+		{
+			name:     "method not found",
+			request:  `{"jsonrpc": "2.0", "method": "Sub", "id": 1}`,
+			status:   http.StatusNotFound,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32601, "message": "method not found: Sub"}, "id": 1}`,
+		},
+		{
+			name:    "notification",
+			request: `{"jsonrpc": "2.0", "method": "Notify", "params": {}}`,
+			status:  http.StatusNoContent,
+		},
+		{
+			name: "batch",
+			request: `[
+				{"jsonrpc": "2.0", "method": "Add", "params": {"A": 2, "B": 2}, "id": 1},
+				{"jsonrpc": "2.0", "method": "Notify"},
+				{"jsonrpc": "2.0", "method": "Error", "id": 2},
+				42
+			]`,
+			status: http.StatusOK,
+			response: `[
+				{"jsonrpc": "2.0", "result": {"Sum": 4}, "id": 1},
+				{"jsonrpc": "2.0", "error": {"code": -32603, "message": "cache is empty"}, "id": 2},
+				{"jsonrpc": "2.0", "error": {"code": -32600, "message": "invalid request"}, "id": null}
+			]`,
+		},
+		{
+			name:     "empty batch",
+			request:  `[]`,
+			status:   http.StatusBadRequest,
+			response: `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "invalid request"}, "id": null}`,
+		},
+		{
+			name:    "batch of notifications",
+			request: `[{"jsonrpc": "2.0", "method": "Notify"}, {"jsonrpc": "2.0", "method": "Notify"}]`,
+			status:  http.StatusNoContent,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp, err := http.Post(server.URL, "application/json", strings.NewReader(tc.request))
+			require.NoError(t, err)
+			defer rsp.Body.Close()
+
+			body, err := io.ReadAll(rsp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.status, rsp.StatusCode)
+			if tc.response == "" {
+				require.Empty(t, body)
+			} else {
+				require.JSONEq(t, tc.response, string(body))
+			}
+		})
+	}
+
+	require.Equal(t, int32(4), service.notified.Load())
+
+	t.Run("invalid params", func(t *testing.T) {
+		rsp, err := http.Post(server.URL, "application/json",
+			strings.NewReader(`{"jsonrpc": "2.0", "method": "Add", "params": [1, 2], "id": 1}`))
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		var response struct{ Error *Error }
+		require.NoError(t, json.NewDecoder(rsp.Body).Decode(&response))
+		require.Equal(t, CodeInvalidParams, response.Error.Code)
+	})
+
+	t.Run("call error", func(t *testing.T) {
+		err := Call(context.Background(), server.URL, "Sub", &AddRequest{}, &AddResponse{})
+
+		var rpcErr *Error
+		require.True(t, errors.As(err, &rpcErr))
+		require.Equal(t, CodeMethodNotFound, rpcErr.Code)
+	})
+}
+
+func TestJSONRPC_BatchLimits(t *testing.T) {
+	var running, peak atomic.Int32
+	track := func(ctx context.Context, method string, req any, next Handler) (any, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		return next(ctx, req)
+	}
+
+	server := httptest.NewServer(MakeHandler(&testService{},
+		WithInterceptors(track), WithMaxBatchSize(8), WithBatchConcurrency(2)))
+	defer server.Close()
+
+	post := func(n int) (int, string) {
+		calls := strings.Repeat(`{"jsonrpc": "2.0", "method": "Ping", "id": 1},`, n)
+		rsp, err := http.Post(server.URL, "application/json", strings.NewReader("["+strings.TrimSuffix(calls, ",")+"]"))
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		return rsp.StatusCode, string(body)
+	}
+
+	status, body := post(8)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 8, strings.Count(body, `"result"`))
+	require.LessOrEqual(t, peak.Load(), int32(2))
+
+	status, body = post(9)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.JSONEq(t, `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "batch of 9 requests exceeds 8"}, "id": null}`, body)
+}
+
+func TestJSONRPC_Errors(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&testService{}))
+	defer server.Close()
+
+	lookup := func(user string) error {
+		return Call(context.Background(), server.URL, "Lookup", &LookupRequest{User: user}, &LookupResponse{})
+	}
+
+	t.Run("sentinel", func(t *testing.T) {
+		err := lookup("bob")
+		require.ErrorIs(t, err, ErrNoSuchUser)
+		require.Contains(t, err.Error(), `user "bob": no such user`)
+
+		var rpcErr *Error
+		require.ErrorAs(t, err, &rpcErr)
+		require.Equal(t, 1001, rpcErr.Code)
+	})
+
+	t.Run("type", func(t *testing.T) {
+		err := lookup("greedy")
+		require.NotErrorIs(t, err, ErrNoSuchUser)
+
+		var quotaErr *QuotaError
+		require.ErrorAs(t, err, &quotaErr)
+		require.Equal(t, 10, quotaErr.Limit)
+	})
+
+	t.Run("predefined", func(t *testing.T) {
+		require.ErrorIs(t, lookup(""), ErrInvalidParams)
+
+		err := Call(context.Background(), server.URL, "Missing", &LookupRequest{}, &LookupResponse{})
+		require.ErrorIs(t, err, ErrMethodNotFound)
+	})
+
+	t.Run("error object", func(t *testing.T) {
+		var rpcErr *Error
+		require.ErrorAs(t, lookup("custom"), &rpcErr)
+		require.Equal(t, 42, rpcErr.Code)
+		require.Equal(t, "custom", rpcErr.Message)
+		require.JSONEq(t, `{"reason":"test"}`, string(rpcErr.Data))
+		require.Nil(t, rpcErr.Unwrap())
+	})
+
+	t.Run("status", func(t *testing.T) {
+		for user, status := range map[string]int{
+			"bob":    http.StatusNotFound,
+			"greedy": http.StatusTooManyRequests,
+			"":       http.StatusBadRequest,
+			"custom": http.StatusInternalServerError,
+		} {
+			body := fmt.Sprintf(`{"jsonrpc": "2.0", "method": "Lookup", "params": {"User": %q}, "id": 1}`, user)
+			rsp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			rsp.Body.Close()
+			require.Equal(t, status, rsp.StatusCode, user)
+
+			rsp, err = http.Post(server.URL+"/Lookup", "application/json", strings.NewReader(fmt.Sprintf(`{"User": %q}`, user)))
+			require.NoError(t, err)
+			rsp.Body.Close()
+			require.Equal(t, status, rsp.StatusCode, user)
+		}
+	})
+
+	t.Run("register", func(t *testing.T) {
+		require.Panics(t, func() { RegisterError(errors.New("reserved"), CodeInternalError, http.StatusInternalServerError) })
+		require.Panics(t, func() { RegisterError(errors.New("twice"), 1001, http.StatusNotFound) })
+	})
+}
+
+type brokenService struct{}
+
+func (*brokenService) Valid(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+	return &PingResponse{}, nil
+}
+
+func (*brokenService) NoContext(req *PingRequest) (*PingResponse, error) {
+	return &PingResponse{}, nil
+}
+
+func (*brokenService) ValueRequest(ctx context.Context, req PingRequest) (*PingResponse, error) {
+	return &PingResponse{}, nil
+}
+
+func (*brokenService) NoError(ctx context.Context, req *PingRequest) *PingResponse {
+	return &PingResponse{}
+}
+
+func (*brokenService) WrongContext(ctx *context.Context, req *PingRequest) (*PingResponse, error) {
+	return &PingResponse{}, nil
+}
+
+func TestNewService(t *testing.T) {
+	s := NewService(&brokenService{})
+	require.Equal(t, "brokenService", s.Name)
+
+	require.Len(t, s.Methods, 1)
+	require.Equal(t, "Valid", s.Methods[0].Name)
+	require.Equal(t, reflect.TypeOf(PingRequest{}), s.Methods[0].Request)
+	require.Equal(t, reflect.TypeOf(PingResponse{}), s.Methods[0].Response)
+
+	rejected := make(map[string]string)
+	for _, r := range s.Rejected {
+		rejected[r.Name] = r.Err.Error()
+	}
+	require.Len(t, rejected, 4)
+	require.Contains(t, rejected["NoContext"], "takes 1 arguments")
+	require.Contains(t, rejected["ValueRequest"], "second parameter must be a pointer")
+	require.Contains(t, rejected["NoError"], "must return (*Response, error)")
+	require.Contains(t, rejected["WrongContext"], "first parameter must be context.Context")
+}
+
+type Point struct {
+	X, Y float64
+}
+
+type Shape struct {
+	Name    string            `json:"name"`
+	Points  []Point           `json:"points"`
+	Parent  *Shape            `json:"parent,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Created time.Time         `json:"created"`
+	secret  int
+}
+
+type DrawRequest struct {
+	Shape  Shape `json:"shape"`
+	Scale  int   `json:"scale,omitempty"`
+	Ignore bool  `json:"-"`
+}
+
+type DrawResponse struct {
+	Image []byte `json:"image"`
+}
+
+type drawService struct{}
+
+func (*drawService) Draw(ctx context.Context, req *DrawRequest) (*DrawResponse, error) {
+	return &DrawResponse{}, nil
+}
+
+func TestSchema(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&drawService{}))
+	defer server.Close()
+
+	const expected = `{
+		"openrpc": "1.2.6",
+		"info": {"title": "drawService", "version": "1.0.0"},
+		"methods": [{
+			"name": "Draw",
+			"paramStructure": "by-name",
+			"params": [
+				{"name": "scale", "schema": {"type": "integer"}},
+				{"name": "shape", "schema": {"$ref": "#/components/schemas/Shape"}}
+			],
+			"result": {"name": "result", "schema": {"$ref": "#/components/schemas/DrawResponse"}}
+		}],
+		"components": {"schemas": {
+			"DrawResponse": {
+				"type": "object",
+				"properties": {"image": {"type": "string", "format": "byte"}},
+				"required": ["image"]
+			},
+			"Point": {
+				"type": "object",
+				"properties": {"X": {"type": "number"}, "Y": {"type": "number"}},
+				"required": ["X", "Y"]
+			},
+			"Shape": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"points": {"type": "array", "items": {"$ref": "#/components/schemas/Point"}},
+					"parent": {"$ref": "#/components/schemas/Shape"},
+					"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+					"created": {"type": "string", "format": "date-time"}
+				},
+				"required": ["name", "points", "created"]
+			}
+		}}
+	}`
+
+	rsp, err := http.Get(server.URL + "/_schema")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.JSONEq(t, expected, string(body))
+
+	var discovered json.RawMessage
+	require.NoError(t, Call(context.Background(), server.URL, DiscoverMethod, &PingRequest{}, &discovered))
+	require.JSONEq(t, expected, string(discovered))
+}
@@ -0,0 +1,1070 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// msgpackCodec implements MessagePack (https://msgpack.org) for the values
+// encoding/json supports. Structs are maps keyed by the json names of their
+// fields, json.RawMessage holds JSON and is converted to MessagePack on the wire.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var e msgpackEncoder
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: Unmarshal(non-pointer %T)", v)
+	}
+
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("msgpack: invalid data after top-level value")
+	}
+	return nil
+}
+
+func (msgpackCodec) NewDecoder(r io.Reader) Decoder {
+	return &msgpackStream{r: bufio.NewReader(r)}
+}
+
+const (
+	mpNil     = 0xc0
+	mpFalse   = 0xc2
+	mpTrue    = 0xc3
+	mpBin8    = 0xc4
+	mpBin16   = 0xc5
+	mpBin32   = 0xc6
+	mpFloat32 = 0xca
+	mpFloat64 = 0xcb
+	mpUint8   = 0xcc
+	mpUint16  = 0xcd
+	mpUint32  = 0xce
+	mpUint64  = 0xcf
+	mpInt8    = 0xd0
+	mpInt16   = 0xd1
+	mpInt32   = 0xd2
+	mpInt64   = 0xd3
+	mpStr8    = 0xd9
+	mpStr16   = 0xda
+	mpStr32   = 0xdb
+	mpArray16 = 0xdc
+	mpArray32 = 0xdd
+	mpMap16   = 0xde
+	mpMap32   = 0xdf
+)
+
+var (
+	msgpackRawType      = reflect.TypeOf(RawMessage{})
+	jsonNumberType      = reflect.TypeOf(json.Number(""))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// msgpackField is an exported struct field, index leads to it
+// through embedded structs.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var msgpackFields sync.Map // map[reflect.Type][]msgpackField
+
+// structFields lists the fields of t as encoding/json names them.
+// Fields of embedded structs are promoted unless t has a field of the same name.
+func structFields(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFields.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+
+	var fields []msgpackField
+	seen := make(map[string]bool)
+	var promoted []msgpackField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, embedded := range structFields(ft) {
+					embedded.index = append([]int{i}, embedded.index...)
+					promoted = append(promoted, embedded)
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		seen[name] = true
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	for _, f := range promoted {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+
+	msgpackFields.Store(t, fields)
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, mpNil)
+		return nil
+	}
+
+	switch v.Type() {
+	case msgpackRawType:
+		if v.Len() == 0 {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		e.buf = append(e.buf, v.Bytes()...)
+		return nil
+	case rawMessageType:
+		return e.encodeJSON(v.Bytes())
+	case jsonNumberType:
+		return e.encodeNumber(json.Number(v.String()))
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		e.buf = append(e.buf, mpNil)
+		return nil
+	}
+	if v.Kind() != reflect.Interface && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return fmt.Errorf("msgpack: error calling MarshalText for type %v: %w", v.Type(), err)
+		}
+		e.encodeString(string(text))
+		return nil
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		return e.encode(v.Addr())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, mpTrue)
+		} else {
+			e.buf = append(e.buf, mpFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, mpFloat32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.encodeFloat(v.Float())
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x80, mpMap16, mpMap32, 16)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encodeKey(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	case reflect.Ptr, reflect.Interface:
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	var fields []msgpackField
+	var values []reflect.Value
+	for _, f := range structFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index, false)
+		if !ok || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		fields = append(fields, f)
+		values = append(values, fv)
+	}
+
+	e.encodeLen(len(fields), 0x80, mpMap16, mpMap32, 16)
+	for i, f := range fields {
+		e.encodeString(f.name)
+		if err := e.encode(values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex follows index through embedded pointers, allocating them
+// when alloc is set. It reports false for fields behind nil pointers.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func (e *msgpackEncoder) encodeKey(k reflect.Value) error {
+	switch {
+	case k.Kind() == reflect.String:
+		e.encodeString(k.String())
+	case k.Type().Implements(textMarshalerType):
+		return e.encode(k)
+	case k.CanInt():
+		e.encodeInt(k.Int())
+	case k.CanUint():
+		e.encodeUint(k.Uint())
+	default:
+		return fmt.Errorf("msgpack: unsupported map key type %v", k.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeArray(v reflect.Value) error {
+	e.encodeLen(v.Len(), 0x90, mpArray16, mpArray32, 16)
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeLen writes the header of a string, an array or a map,
+// lengths below fixLimit fit into the fix type.
+func (e *msgpackEncoder) encodeLen(n int, fix, code16, code32 byte, fixLimit int) {
+	switch {
+	case n < fixLimit:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, code16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, code32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	if len(s) >= 32 && len(s) <= math.MaxUint8 {
+		e.buf = append(e.buf, mpStr8, byte(len(s)))
+	} else {
+		e.encodeLen(len(s), 0xa0, mpStr16, mpStr32, 32)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	switch {
+	case len(b) <= math.MaxUint8:
+		e.buf = append(e.buf, mpBin8, byte(len(b)))
+	case len(b) <= math.MaxUint16:
+		e.buf = append(e.buf, mpBin16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(len(b)))
+	default:
+		e.buf = append(e.buf, mpBin32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(b)))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, mpInt8, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, mpInt16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, mpInt32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, mpInt64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= math.MaxInt8:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, mpUint8, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, mpUint16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, mpUint32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, mpUint64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+func (e *msgpackEncoder) encodeFloat(f float64) {
+	e.buf = append(e.buf, mpFloat64)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *msgpackEncoder) encodeNumber(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		e.encodeInt(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("msgpack: invalid number %q", n)
+	}
+	e.encodeFloat(f)
+	return nil
+}
+
+// encodeJSON converts a JSON value to MessagePack.
+func (e *msgpackEncoder) encodeJSON(data []byte) error {
+	if len(data) == 0 {
+		e.buf = append(e.buf, mpNil)
+		return nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return fmt.Errorf("msgpack: error while converting json.RawMessage: %w", err)
+	}
+	return e.encode(reflect.ValueOf(v))
+}
+
+// msgpackDecoder decodes a single value from data.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+
+	// lastUint is the last uint64 read by readInt
+	lastUint uint64
+	// depth is the nesting of the value being decoded
+	depth int
+}
+
+// maxMsgpackDepth limits nesting like encoding/json does, deeper data
+// would overflow the stack of the recursive decoder.
+const maxMsgpackDepth = 10000
+
+// maxMsgpackPrealloc bounds the elements allocated ahead for arrays and maps,
+// larger ones grow as they are decoded, so that memory follows the input size.
+const maxMsgpackPrealloc = 1024
+
+// maxMsgpackStreamSize limits values read by the stream decoder,
+// as DefaultMaxBodySize does for requests.
+const maxMsgpackStreamSize = DefaultMaxBodySize
+
+var (
+	errMsgpackShort = fmt.Errorf("msgpack: %w", io.ErrUnexpectedEOF)
+	errMsgpackDepth = errors.New("msgpack: exceeded max depth")
+	errMsgpackSize  = fmt.Errorf("msgpack: value exceeds %d bytes", maxMsgpackStreamSize)
+)
+
+// enter counts a level of nesting, the caller must call leave after it.
+func (d *msgpackDecoder) enter() error {
+	d.depth++
+	if d.depth > maxMsgpackDepth {
+		return errMsgpackDepth
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errMsgpackShort
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return err
+	}
+
+	switch v.Type() {
+	case msgpackRawType:
+		start := d.pos
+		if err := skipValue(d.take, d.depth); err != nil {
+			return err
+		}
+		v.SetBytes(append([]byte(nil), d.data[start:d.pos]...))
+		return nil
+	case rawMessageType:
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Errorf("msgpack: error while converting to json.RawMessage: %w", err)
+		}
+		v.SetBytes(data)
+		return nil
+	}
+
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if c == mpNil {
+		d.pos++
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		s, err := d.readString()
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return d.typeError(c, v.Type())
+		}
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(&x).Elem())
+	case reflect.Bool:
+		switch c {
+		case mpTrue, mpFalse:
+			d.pos++
+			v.SetBool(c == mpTrue)
+		default:
+			return d.typeError(c, v.Type())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok, err := d.readInt()
+		if err != nil {
+			return err
+		}
+		if !ok || v.OverflowInt(n) {
+			return d.typeError(c, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok, err := d.readInt()
+		if err != nil {
+			return err
+		}
+		var u uint64
+		switch {
+		case c == mpUint64:
+			u = d.lastUint
+		case ok && n >= 0:
+			u = uint64(n)
+		default:
+			return d.typeError(c, v.Type())
+		}
+		if v.OverflowUint(u) {
+			return d.typeError(c, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := d.readFloat()
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := d.readString()
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return d.typeError(c, v.Type())
+			}
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		n, err := d.readLen(0x90, mpArray16, mpArray32)
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		s := reflect.New(v.Type()).Elem()
+		s.Set(reflect.MakeSlice(v.Type(), 0, min(n, maxMsgpackPrealloc)))
+		for i := 0; i < n; i++ {
+			if i == s.Cap() {
+				s.Grow(1)
+			}
+			s.SetLen(i + 1)
+			s.Index(i).SetZero()
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		n, err := d.readLen(0x90, mpArray16, mpArray32)
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if err := skipValue(d.take, d.depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	case reflect.Map:
+		n, err := d.readLen(0x80, mpMap16, mpMap32)
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), min(n, maxMsgpackPrealloc)))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		n, err := d.readLen(0x80, mpMap16, mpMap32)
+		if err != nil {
+			return d.typeError(c, v.Type())
+		}
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			name, err := d.readString()
+			if err != nil {
+				return fmt.Errorf("msgpack: struct %v has a key that is not a string", v.Type())
+			}
+			f := lookupField(fields, name)
+			if f == nil {
+				if err := skipValue(d.take, d.depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			fv, _ := fieldByIndex(v, f.index, true)
+			if err := d.decode(fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// lookupField prefers an exact match of the name, like encoding/json.
+func lookupField(fields []msgpackField, name string) *msgpackField {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) typeError(c byte, t reflect.Type) error {
+	return fmt.Errorf("msgpack: cannot decode value of type 0x%02x into Go value of type %v", c, t)
+}
+
+// readInt reads an integer, ok is false when the next value is not an integer.
+// Values of uint64 above math.MaxInt64 are kept in lastUint.
+func (d *msgpackDecoder) readInt() (n int64, ok bool, err error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var size int
+	switch {
+	case c <= 0x7f:
+		d.pos++
+		return int64(c), true, nil
+	case c >= 0xe0:
+		d.pos++
+		return int64(int8(c)), true, nil
+	case c == mpUint8 || c == mpInt8:
+		size = 1
+	case c == mpUint16 || c == mpInt16:
+		size = 2
+	case c == mpUint32 || c == mpInt32:
+		size = 4
+	case c == mpUint64 || c == mpInt64:
+		size = 8
+	default:
+		return 0, false, nil
+	}
+
+	d.pos++
+	b, err := d.take(size)
+	if err != nil {
+		return 0, false, err
+	}
+	u := readUint(b)
+	switch c {
+	case mpInt8:
+		return int64(int8(u)), true, nil
+	case mpInt16:
+		return int64(int16(u)), true, nil
+	case mpInt32:
+		return int64(int32(u)), true, nil
+	case mpInt64:
+		return int64(u), true, nil
+	case mpUint64:
+		d.lastUint = u
+		return int64(u), u <= math.MaxInt64, nil
+	default:
+		return int64(u), true, nil
+	}
+}
+
+func (d *msgpackDecoder) readFloat() (float64, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+	switch c {
+	case mpFloat32:
+		d.pos++
+		b, err := d.take(4)
+		if err != nil {
+			return 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case mpFloat64:
+		d.pos++
+		b, err := d.take(8)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+
+	n, ok, err := d.readInt()
+	if err != nil {
+		return 0, err
+	}
+	if c == mpUint64 {
+		return float64(d.lastUint), nil
+	}
+	if !ok {
+		return 0, errors.New("msgpack: not a number")
+	}
+	return float64(n), nil
+}
+
+func (d *msgpackDecoder) readString() (string, error) {
+	c, err := d.peek()
+	if err != nil {
+		return "", err
+	}
+	if c == mpBin8 || c == mpBin16 || c == mpBin32 {
+		return "", errors.New("msgpack: not a string")
+	}
+	b, err := d.readBytes()
+	return string(b), err
+}
+
+// readBytes reads a string or a binary.
+func (d *msgpackDecoder) readBytes() ([]byte, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch {
+	case c >= 0xa0 && c <= 0xbf:
+		d.pos++
+		n = int(c & 0x1f)
+	case c == mpStr8 || c == mpBin8:
+		n, err = d.readSize(1)
+	case c == mpStr16 || c == mpBin16:
+		n, err = d.readSize(2)
+	case c == mpStr32 || c == mpBin32:
+		n, err = d.readSize(4)
+	default:
+		return nil, errors.New("msgpack: not a string")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.take(n)
+}
+
+// readLen reads the header of an array or a map.
+func (d *msgpackDecoder) readLen(fix, code16, code32 byte) (int, error) {
+	c, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	switch {
+	case c&0xf0 == fix:
+		d.pos++
+		n = int(c & 0x0f)
+	case c == code16:
+		n, err = d.readSize(2)
+	case c == code32:
+		n, err = d.readSize(4)
+	default:
+		return 0, errors.New("msgpack: unexpected type")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// every element takes at least a byte
+	if n > len(d.data)-d.pos {
+		return 0, errMsgpackShort
+	}
+	return n, nil
+}
+
+// decodeAny decodes the next value like encoding/json decodes into an interface,
+// except that integers are int64 or uint64 and binaries are []byte.
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c == mpNil:
+		d.pos++
+		return nil, nil
+	case c == mpTrue || c == mpFalse:
+		d.pos++
+		return c == mpTrue, nil
+	case c == mpFloat32 || c == mpFloat64:
+		return d.readFloat()
+	case c >= 0xa0 && c <= 0xbf || c == mpStr8 || c == mpStr16 || c == mpStr32:
+		return d.readString()
+	case c == mpBin8 || c == mpBin16 || c == mpBin32:
+		b, err := d.readBytes()
+		return append([]byte{}, b...), err
+	case c&0xf0 == 0x90 || c == mpArray16 || c == mpArray32:
+		n, err := d.readLen(0x90, mpArray16, mpArray32)
+		if err != nil {
+			return nil, err
+		}
+		a := make([]any, 0, min(n, maxMsgpackPrealloc))
+		for range n {
+			item, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, item)
+		}
+		return a, nil
+	case c&0xf0 == 0x80 || c == mpMap16 || c == mpMap32:
+		n, err := d.readLen(0x80, mpMap16, mpMap32)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]any, min(n, maxMsgpackPrealloc))
+		for i := 0; i < n; i++ {
+			k, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			if m[fmt.Sprint(k)], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	n, ok, err := d.readInt()
+	switch {
+	case err != nil:
+		return nil, err
+	case c == mpUint64 && !ok:
+		return d.lastUint, nil
+	case !ok:
+		return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+	}
+	return n, nil
+}
+
+// readSize skips the type byte and reads a length of size bytes.
+func (d *msgpackDecoder) readSize(size int) (int, error) {
+	d.pos++
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	return int(readUint(b)), nil
+}
+
+func readUint(b []byte) uint64 {
+	var u uint64
+	for _, x := range b {
+		u = u<<8 | uint64(x)
+	}
+	return u
+}
+
+// skipValue reads a whole value nested depth levels deep with take,
+// it does not look into it beyond its length.
+func skipValue(take func(n int) ([]byte, error), depth int) error {
+	if depth > maxMsgpackDepth {
+		return errMsgpackDepth
+	}
+
+	b, err := take(1)
+	if err != nil {
+		return err
+	}
+	c := b[0]
+
+	// size is the length of the payload, or of the length for lenSize,
+	// values is the number of nested values
+	var size, lenSize, values int
+	switch {
+	case c <= 0x7f || c >= 0xe0 || c == mpNil || c == mpFalse || c == mpTrue:
+	case c >= 0xa0 && c <= 0xbf:
+		size = int(c & 0x1f)
+	case c&0xf0 == 0x90:
+		values = int(c & 0x0f)
+	case c&0xf0 == 0x80:
+		values = 2 * int(c&0x0f)
+	case c == mpUint8 || c == mpInt8:
+		size = 1
+	case c == mpUint16 || c == mpInt16:
+		size = 2
+	case c == mpUint32 || c == mpInt32 || c == mpFloat32:
+		size = 4
+	case c == mpUint64 || c == mpInt64 || c == mpFloat64:
+		size = 8
+	case c == mpStr8 || c == mpBin8 || c == 0xc7:
+		lenSize = 1
+	case c == mpStr16 || c == mpBin16 || c == 0xc8 || c == mpArray16 || c == mpMap16:
+		lenSize = 2
+	case c == mpStr32 || c == mpBin32 || c == 0xc9 || c == mpArray32 || c == mpMap32:
+		lenSize = 4
+	case c >= 0xd4 && c <= 0xd8:
+		// fixext: a type byte and 1 to 16 bytes of data
+		size = 1 + 1<<(c-0xd4)
+	default:
+		return fmt.Errorf("msgpack: invalid type 0x%02x", c)
+	}
+
+	if lenSize != 0 {
+		b, err := take(lenSize)
+		if err != nil {
+			return err
+		}
+		n := int(readUint(b))
+		switch c {
+		case mpArray16, mpArray32:
+			values = n
+		case mpMap16, mpMap32:
+			values = 2 * n
+		case 0xc7, 0xc8, 0xc9:
+			size = n + 1
+		default:
+			size = n
+		}
+	}
+
+	if _, err := take(size); err != nil {
+		return err
+	}
+	for i := 0; i < values; i++ {
+		if err := skipValue(take, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackStream decodes a sequence of values written one after another.
+type msgpackStream struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func (s *msgpackStream) Decode(v any) error {
+	if _, err := s.r.Peek(1); err != nil {
+		return err
+	}
+
+	s.buf = s.buf[:0]
+	err := skipValue(func(n int) ([]byte, error) {
+		// lengths come from the peer, they are checked before allocating
+		if n > maxMsgpackStreamSize-len(s.buf) {
+			return nil, errMsgpackSize
+		}
+		start := len(s.buf)
+		s.buf = append(s.buf, make([]byte, n)...)
+		if _, err := io.ReadFull(s.r, s.buf[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return s.buf[start:], nil
+	}, 1)
+	if err != nil {
+		return err
+	}
+	return MessagePack.Unmarshal(s.buf, v)
+}
@@ -0,0 +1,79 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Version is the only JSON-RPC version accepted by the handler.
+const Version = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is the error object of a JSON-RPC response.
+// Methods may return it to choose the code and data themselves.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Data is JSON whatever the codec of the call.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// err is the registered error of the code, it is set by Call
+	err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// request is a JSON-RPC request. A request without id is a notification,
+// the server does not answer it.
+type request struct {
+	JSONRPC string     `json:"jsonrpc"`
+	Method  string     `json:"method"`
+	Params  RawMessage `json:"params,omitempty"`
+	ID      RawMessage `json:"id,omitempty"`
+}
+
+func (r *request) isNotification() bool {
+	return r.ID == nil
+}
+
+// response holds either a result or an error. The id is null
+// when the id of the request could not be determined.
+type response struct {
+	JSONRPC string     `json:"jsonrpc"`
+	Result  RawMessage `json:"result,omitempty"`
+	Error   *Error     `json:"error,omitempty"`
+	ID      RawMessage `json:"id"`
+}
+
+func newErrorResponse(id RawMessage, code int, message string) *response {
+	return &response{
+		JSONRPC: Version,
+		Error:   &Error{Code: code, Message: message},
+		ID:      id,
+	}
+}
+
+// status is the http status of a response sent alone.
+func (r *response) status() int {
+	if r.Error != nil {
+		return HTTPStatus(r.Error.Code)
+	}
+	return http.StatusOK
+}
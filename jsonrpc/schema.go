@@ -0,0 +1,244 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiscoverMethod returns the OpenRPC description of the service.
+const DiscoverMethod = "rpc.discover"
+
+const openRPCVersion = "1.2.6"
+
+// schema is a JSON Schema of a Go type as encoding/json sees it.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+type contentDescriptor struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *schema `json:"schema"`
+}
+
+type openRPCMethod struct {
+	Name           string               `json:"name"`
+	ParamStructure string               `json:"paramStructure"`
+	Params         []*contentDescriptor `json:"params"`
+	Result         *contentDescriptor   `json:"result"`
+	// Streaming methods send a sequence of results.
+	Streaming bool `json:"x-streaming,omitempty"`
+}
+
+type openRPCDocument struct {
+	OpenRPC string `json:"openrpc"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Methods    []*openRPCMethod `json:"methods"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// OpenRPC returns the OpenRPC document describing the methods of s.
+// Named struct types are described once in components.schemas.
+func (s *Service) OpenRPC() json.RawMessage {
+	var doc openRPCDocument
+	doc.OpenRPC = openRPCVersion
+	doc.Info.Title = s.Name
+	doc.Info.Version = "1.0.0"
+
+	g := &schemaGenerator{names: make(map[reflect.Type]string), schemas: make(map[string]*schema)}
+	doc.Methods = []*openRPCMethod{}
+	for _, m := range s.Methods {
+		doc.Methods = append(doc.Methods, &openRPCMethod{
+			Name:           m.Name,
+			ParamStructure: "by-name",
+			Params:         g.params(m.Request),
+			Result:         &contentDescriptor{Name: "result", Schema: g.schema(m.Response)},
+			Streaming:      m.Streaming,
+		})
+	}
+	doc.Components.Schemas = g.schemas
+
+	data, err := json.Marshal(&doc)
+	if err != nil {
+		panic(fmt.Sprintf("jsonrpc: encoding schema: %v", err))
+	}
+	return data
+}
+
+type schemaGenerator struct {
+	names   map[reflect.Type]string
+	schemas map[string]*schema
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// params describes the fields of a struct request as separate by-name params.
+// Missing fields are decoded as zero values, so none of them is required.
+func (g *schemaGenerator) params(t reflect.Type) []*contentDescriptor {
+	params := []*contentDescriptor{}
+	if t.Kind() != reflect.Struct {
+		return append(params, &contentDescriptor{Name: "params", Required: true, Schema: g.schema(t)})
+	}
+
+	s := g.inline(t)
+	for _, name := range sortedKeys(s.Properties) {
+		params = append(params, &contentDescriptor{
+			Name:   name,
+			Schema: s.Properties[name],
+		})
+	}
+	return params
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.inline(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + g.define(t)}
+	default:
+		// interfaces accept anything, channels and functions can not be encoded
+		return &schema{}
+	}
+}
+
+// define adds the schema of a named struct to the components
+// and returns its name there. Types are registered before their fields
+// are described, so recursive types refer to themselves.
+func (g *schemaGenerator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", t.Name(), i)
+	}
+	g.names[t] = name
+	g.schemas[name] = &schema{}
+	*g.schemas[name] = *g.inline(t)
+	return name
+}
+
+// inline describes the fields of a struct as encoding/json encodes them.
+func (g *schemaGenerator) inline(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := g.inline(ft)
+				for k, v := range embedded.Properties {
+					if _, ok := s.Properties[k]; !ok {
+						s.Properties[k] = v
+					}
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+func sortedKeys(m map[string]*schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// discover answers rpc.discover, the document is converted to the codec of the call.
+func (s *server) discover(out Codec, id RawMessage) *response {
+	return &response{JSONRPC: Version, Result: transcode(RawMessage(s.schema), JSON, out), ID: id}
+}
+
+func (s *server) serveSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.schema)
+}
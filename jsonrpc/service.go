@@ -0,0 +1,177 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Service is an object whose methods are exposed over RPC.
+type Service struct {
+	// Name is the name of the type of the object.
+	Name string
+	// Methods are the exposed methods in alphabetical order.
+	Methods []MethodInfo
+	// Rejected are the exported methods that do not have
+	// the signature of an RPC method, with the reason.
+	Rejected []RejectedMethod
+
+	methods map[string]*method
+}
+
+// MethodInfo describes an exposed method.
+type MethodInfo struct {
+	Name    string
+	Request reflect.Type
+	// Response is the type of the items for streaming methods.
+	Response reflect.Type
+	// Streaming methods send their results through a Stream.
+	Streaming bool
+}
+
+// RejectedMethod is an exported method that is not exposed.
+type RejectedMethod struct {
+	Name string
+	Err  error
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// NewService collects the RPC methods of obj, they have the signature
+//
+//	Method(ctx context.Context, req *Request) (*Response, error)
+//
+// or stream their results with the signature
+//
+//	Method(ctx context.Context, req *Request, stream Stream[*Item]) error
+func NewService(obj interface{}) *Service {
+	objT := reflect.TypeOf(obj)
+	s := &Service{
+		Name:    typeName(objT),
+		methods: make(map[string]*method),
+	}
+	for i := 0; i < objT.NumMethod(); i++ {
+		m := objT.Method(i)
+		if err := s.register(obj, m); err != nil {
+			s.Rejected = append(s.Rejected, RejectedMethod{Name: m.Name, Err: err})
+		}
+	}
+	return s
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func (s *Service) register(obj interface{}, m reflect.Method) error {
+	if err := checkSignature(m.Type); err != nil {
+		return fmt.Errorf("while register %v method: %w", m.Name, err)
+	}
+
+	inputType := m.Type.In(2).Elem()
+	if m.Type.NumIn() == 4 {
+		streamType := m.Type.In(3)
+		outputType := streamItemType(streamType)
+		for outputType.Kind() == reflect.Ptr {
+			outputType = outputType.Elem()
+		}
+		s.methods[m.Name] = &method{obj: reflect.ValueOf(obj), f: m.Func, inputType: inputType, streamType: streamType}
+		s.Methods = append(s.Methods, MethodInfo{Name: m.Name, Request: inputType, Response: outputType, Streaming: true})
+		return nil
+	}
+
+	outputType := m.Type.Out(0).Elem()
+	s.methods[m.Name] = &method{obj: reflect.ValueOf(obj), f: m.Func, inputType: inputType}
+	s.Methods = append(s.Methods, MethodInfo{Name: m.Name, Request: inputType, Response: outputType})
+	return nil
+}
+
+// checkSignature checks the type of a method value including its receiver.
+func checkSignature(mt reflect.Type) error {
+	if mt.NumIn() != 3 && mt.NumIn() != 4 {
+		return fmt.Errorf("takes %d arguments instead of (context.Context, *Request)", mt.NumIn()-1)
+	}
+	if mt.In(1) != contextType {
+		return fmt.Errorf("first parameter must be context.Context")
+	}
+	if mt.In(2).Kind() != reflect.Ptr {
+		return fmt.Errorf("second parameter must be a pointer")
+	}
+	if mt.NumIn() == 4 {
+		if !isStream(mt.In(3)) {
+			return fmt.Errorf("third parameter must be a Stream")
+		}
+		if mt.NumOut() != 1 || mt.Out(0) != errorType {
+			return fmt.Errorf("streaming method must return error")
+		}
+		return nil
+	}
+	if mt.NumOut() != 2 || mt.Out(0).Kind() != reflect.Ptr || mt.Out(1) != errorType {
+		return fmt.Errorf("must return (*Response, error)")
+	}
+	return nil
+}
+
+// Handler serves the methods of the service. The root endpoint speaks
+// JSON-RPC 2.0, every method but the streaming ones is also available
+// at /<MethodName> with raw JSON bodies for older clients. GET /_schema and the rpc.discover
+// method return the OpenRPC description of the service.
+// Calls of the methods go through the interceptors of the options,
+// a panicking method fails with an internal error.
+func (s *Service) Handler(opts ...Option) http.Handler {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	mux := http.NewServeMux()
+	srv := &server{
+		methods:      s.methods,
+		handlers:     make(map[string]Handler),
+		codecs:       newCodecs(o.codecs),
+		schema:       s.OpenRPC(),
+		maxBodySize:  o.maxBodySize,
+		maxBatch:     o.maxBatch,
+		batchWorkers: o.batchWorkers,
+	}
+	for name, m := range s.methods {
+		srv.handlers[name] = chain(name, m.call, o.interceptors)
+	}
+	for name, m := range s.methods {
+		if m.streamType == nil {
+			mux.Handle("/"+name, srv.serveMethod(name))
+		}
+	}
+	mux.HandleFunc("/_schema", srv.serveSchema)
+	mux.Handle("/", srv)
+	return withTimeout(mux)
+}
+
+// withTimeout bounds the context of the request by the TimeoutHeader
+// sent by the client, so that methods stop when the caller gives up.
+func withTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get(TimeoutHeader); value != "" {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				http.Error(w, "invalid "+TimeoutHeader+" header: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
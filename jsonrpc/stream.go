@@ -0,0 +1,264 @@
+//go:build !solution
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// StreamContentType is the content type of streamed responses, every line
+// of the body is a response carrying one item, or the error that ended the stream.
+const StreamContentType = "application/x-ndjson"
+
+// ErrStreamClosed is returned by Send after the method has returned.
+var ErrStreamClosed = errors.New("stream is closed")
+
+// Stream sends the items of a streaming method to the caller.
+// Streaming methods have the signature
+//
+//	Method(ctx context.Context, req *Request, stream Stream[*Item]) error
+type Stream[T any] struct {
+	w *streamWriter
+}
+
+// Send writes item to the caller. It fails when the caller has gone away,
+// the method should stop then.
+func (s Stream[T]) Send(item T) error {
+	return s.w.send(item)
+}
+
+// rawStream has the underlying type of every Stream[T],
+// the handler converts it to the stream type of the method.
+type rawStream struct {
+	w *streamWriter
+}
+
+var rawStreamType = reflect.TypeOf(rawStream{})
+
+func isStream(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != rawStreamType && t.ConvertibleTo(rawStreamType) &&
+		t.PkgPath() == rawStreamType.PkgPath() && strings.HasPrefix(t.Name(), "Stream[")
+}
+
+// streamItemType returns T of Stream[T].
+func streamItemType(t reflect.Type) reflect.Type {
+	send, _ := t.MethodByName("Send")
+	return send.Type.In(1)
+}
+
+type streamKey struct{}
+
+// streamWriter writes the items of a single call, the header is sent
+// with the first item, so that a method failing early gets a plain response.
+type streamWriter struct {
+	ctx   context.Context
+	w     http.ResponseWriter
+	codec Codec
+	id    RawMessage
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+}
+
+func (s *streamWriter) send(item any) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	result, err := s.codec.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error while encoding item: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	return s.writeLocked(&response{JSONRPC: Version, Result: result, ID: s.id})
+}
+
+func (s *streamWriter) writeLocked(rsp *response) error {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", streamContentType(s.codec))
+		s.w.WriteHeader(http.StatusOK)
+	}
+
+	line, _ := s.codec.Marshal(rsp)
+	if s.codec.ContentType() == JSON.ContentType() {
+		line = append(line, '\n')
+	}
+	if _, err := s.w.Write(line); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// close finishes the stream. It reports whether any item was sent,
+// otherwise the caller still has to write the response.
+func (s *streamWriter) close(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if !s.started {
+		return false
+	}
+	if err != nil {
+		_ = s.writeLocked(&response{JSONRPC: Version, Error: toError(err), ID: s.id})
+	}
+	return true
+}
+
+// serveStream runs a streaming method. Its items are flushed as soon as they
+// are sent, the context of the method is cancelled when the caller disconnects.
+func (s *server) serveStream(w http.ResponseWriter, r *http.Request, in, out Codec, req *request) {
+	sw := &streamWriter{ctx: r.Context(), w: w, codec: out, id: req.ID}
+
+	rsp := func() *response {
+		inValue, err := s.methods[req.Method].decode(in, req.Params)
+		if err != nil {
+			return newErrorResponse(req.ID, CodeInvalidParams, "invalid params: "+err.Error())
+		}
+
+		ctx := context.WithValue(r.Context(), streamKey{}, sw)
+		_, err = s.handlers[req.Method](ctx, inValue.Interface())
+		if sw.close(err) {
+			return nil
+		}
+		if err != nil {
+			return &response{JSONRPC: Version, Error: toError(err), ID: req.ID}
+		}
+		return nil
+	}()
+
+	// a stream without items is an empty body
+	if rsp == nil {
+		if !sw.started {
+			w.Header().Set("Content-Type", streamContentType(out))
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	outBytes, _ := out.Marshal(rsp)
+	w.Header().Set("Content-Type", out.ContentType())
+	w.WriteHeader(rsp.status())
+	w.Write(outBytes)
+}
+
+// CallStream invokes a streaming method and iterates over its items.
+// The iteration ends with an error when the call or the method fails,
+// breaking out of the loop cancels the call.
+func CallStream[Req, Item any](ctx context.Context, c *Client, method string, req *Req) iter.Seq2[*Item, error] {
+	return func(yield func(*Item, error) bool) {
+		for result, err := range c.stream(ctx, method, req) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			item := new(Item)
+			if err := c.codec.Unmarshal(result, item); err != nil {
+				yield(nil, fmt.Errorf("error while decoding item: %w", err))
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) stream(ctx context.Context, method string, req interface{}) iter.Seq2[RawMessage, error] {
+	return func(yield func(RawMessage, error) bool) {
+		// leaving the loop early cancels the call
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ctx, cancelTimeout := c.withTimeout(ctx)
+		defer cancelTimeout()
+
+		id, err := c.nextID()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		payload, err := c.encode(method, req, id)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		post, err := c.newRequest(ctx, payload)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		post.Header.Set("Accept", streamContentType(c.codec))
+
+		httpRsp, err := c.httpClient.Do(post)
+		if err != nil {
+			yield(nil, fmt.Errorf("error while making request from client: %w", err))
+			return
+		}
+		defer httpRsp.Body.Close()
+
+		switch {
+		case hasContentType(httpRsp.Header, streamContentType(c.codec)) && httpRsp.StatusCode == http.StatusOK:
+		case hasContentType(httpRsp.Header, c.codec.ContentType()):
+			// the method failed before sending anything
+			var rsp response
+			if err := c.codec.NewDecoder(httpRsp.Body).Decode(&rsp); err != nil {
+				yield(nil, fmt.Errorf("error while decoding response: %w", err))
+				return
+			}
+			if rsp.Error != nil {
+				rsp.Error.resolve()
+				yield(nil, rsp.Error)
+				return
+			}
+			yield(nil, fmt.Errorf("method %s is not streaming", method))
+			return
+		default:
+			yield(nil, fmt.Errorf("server error: %s", httpRsp.Status))
+			return
+		}
+
+		// a stream cut short fails with io.ErrUnexpectedEOF
+		decoder := c.codec.NewDecoder(httpRsp.Body)
+		for {
+			var rsp response
+			err := decoder.Decode(&rsp)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("error while decoding response: %w", err))
+				return
+			}
+			if rsp.Error != nil {
+				rsp.Error.resolve()
+				yield(nil, rsp.Error)
+				return
+			}
+			if !bytes.Equal(rsp.ID, id) {
+				yield(nil, fmt.Errorf("response id %s does not match request id %s", rsp.ID, id))
+				return
+			}
+			if !yield(rsp.Result, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type streamService struct {
+	stopped chan error
+}
+
+type CountRequest struct {
+	N        int
+	FailAt   int
+	Infinite bool
+}
+
+type CountItem struct {
+	I int
+}
+
+func (s *streamService) Count(ctx context.Context, req *CountRequest, stream Stream[*CountItem]) error {
+	if req.N < 0 {
+		return ErrNoSuchUser
+	}
+	for i := 0; req.Infinite || i < req.N; i++ {
+		if req.FailAt != 0 && i == req.FailAt {
+			return &QuotaError{Limit: i}
+		}
+		if err := stream.Send(&CountItem{I: i}); err != nil {
+			s.stopped <- err
+			return err
+		}
+	}
+	return nil
+}
+
+func (*streamService) Add(ctx context.Context, req *AddRequest) (*AddResponse, error) {
+	return &AddResponse{Sum: req.A + req.B}, nil
+}
+
+func collect(t *testing.T, c *Client, req *CountRequest) ([]int, error) {
+	t.Helper()
+
+	var items []int
+	for item, err := range CallStream[CountRequest, CountItem](context.Background(), c, "Count", req) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item.I)
+	}
+	return items, nil
+}
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&streamService{}))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	items, err := collect(t, c, &CountRequest{N: 5})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3, 4}, items)
+
+	items, err = collect(t, c, &CountRequest{N: 0})
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	_, err = collect(t, c, &CountRequest{N: -1})
+	require.ErrorIs(t, err, ErrNoSuchUser)
+
+	items, err = collect(t, c, &CountRequest{N: 5, FailAt: 3})
+	require.Equal(t, []int{0, 1, 2}, items)
+	var quotaErr *QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, 3, quotaErr.Limit)
+
+	for _, err := range CallStream[AddRequest, AddResponse](context.Background(), c, "Add", &AddRequest{}) {
+		require.ErrorContains(t, err, "not streaming")
+	}
+}
+
+func TestStream_Protocol(t *testing.T) {
+	server := httptest.NewServer(MakeHandler(&streamService{}))
+	defer server.Close()
+
+	rsp, err := http.Post(server.URL, "application/json",
+		strings.NewReader(`{"jsonrpc": "2.0", "method": "Count", "params": {"N": 2}, "id": 7}`))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, StreamContentType, rsp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"jsonrpc":"2.0","result":{"I":0},"id":7}
+{"jsonrpc":"2.0","result":{"I":1},"id":7}
+`, string(body))
+
+	// streams can not be batched
+	rsp, err = http.Post(server.URL, "application/json",
+		strings.NewReader(`[{"jsonrpc": "2.0", "method": "Count", "params": {"N": 2}, "id": 1}]`))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	body, err = io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), fmt.Sprint(CodeInvalidRequest))
+
+	// nor called at the legacy endpoint
+	rsp, err = http.Post(server.URL+"/Count", "application/json", strings.NewReader(`{"N": 2}`))
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+}
+
+func TestStream_Cancel(t *testing.T) {
+	service := &streamService{stopped: make(chan error, 1)}
+	server := httptest.NewServer(MakeHandler(service))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	n := 0
+	for item, err := range CallStream[CountRequest, CountItem](context.Background(), c, "Count", &CountRequest{Infinite: true}) {
+		require.NoError(t, err)
+		require.Equal(t, n, item.I)
+		if n++; n == 3 {
+			break
+		}
+	}
+
+	select {
+	case err := <-service.stopped:
+		require.Error(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("method was not stopped after the caller went away")
+	}
+}
+
+func TestNewService_Stream(t *testing.T) {
+	s := NewService(&streamService{})
+	require.Empty(t, s.Rejected)
+	require.Len(t, s.Methods, 2)
+	require.Equal(t, MethodInfo{
+		Name:      "Count",
+		Request:   reflect.TypeOf(CountRequest{}),
+		Response:  reflect.TypeOf(CountItem{}),
+		Streaming: true,
+	}, s.Methods[1])
+}
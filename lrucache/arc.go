@@ -0,0 +1,141 @@
+//go:build !solution
+
+package lrucache
+
+import "container/list"
+
+// arcList is a list of the adaptive replacement cache.
+type arcList int
+
+const (
+	// t1 holds entries seen once recently, t2 holds entries seen at least twice.
+	t1 arcList = iota
+	t2
+	// b1 and b2 remember keys recently evicted from t1 and t2.
+	b1
+	b2
+)
+
+type arcEntry struct {
+	key, value int
+	list       arcList
+}
+
+// arcCache implements ARC by Megiddo and Modha. It balances between
+// recency and frequency by adapting the target size p of t1: hits of keys
+// evicted from t1 grow it, hits of keys evicted from t2 shrink it.
+type arcCache struct {
+	cap   int
+	p     int
+	lists [4]*list.List
+	items map[int]*list.Element
+}
+
+// NewARC returns an adaptive replacement cache. Range visits entries seen
+// once, then entries seen several times, each from least to most recently used.
+func NewARC(cap int) Cache {
+	c := &arcCache{cap: cap, items: make(map[int]*list.Element, 2*cap)}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+func (c *arcCache) len(l arcList) int {
+	return c.lists[l].Len()
+}
+
+func (c *arcCache) move(el *list.Element, to arcList) {
+	e := c.lists[el.Value.(*arcEntry).list].Remove(el).(*arcEntry)
+	e.list = to
+	c.items[e.key] = c.lists[to].PushFront(e)
+}
+
+func (c *arcCache) removeLRU(l arcList) {
+	e := c.lists[l].Remove(c.lists[l].Back()).(*arcEntry)
+	delete(c.items, e.key)
+}
+
+func (c *arcCache) Get(key int) (int, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+	e := el.Value.(*arcEntry)
+	if e.list != t1 && e.list != t2 {
+		return 0, false
+	}
+	c.move(el, t2)
+	return e.value, true
+}
+
+func (c *arcCache) Set(key, value int) {
+	if c.cap <= 0 {
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*arcEntry)
+		switch e.list {
+		case b1:
+			c.p = min(c.cap, c.p+max(c.len(b2)/c.len(b1), 1))
+			c.replace(false)
+		case b2:
+			c.p = max(0, c.p-max(c.len(b1)/c.len(b2), 1))
+			c.replace(true)
+		}
+		e.value = value
+		c.move(el, t2)
+		return
+	}
+
+	if l1 := c.len(t1) + c.len(b1); l1 == c.cap {
+		if c.len(t1) < c.cap {
+			c.removeLRU(b1)
+			c.replace(false)
+		} else {
+			c.removeLRU(t1)
+		}
+	} else if total := l1 + c.len(t2) + c.len(b2); total >= c.cap {
+		if total == 2*c.cap {
+			c.removeLRU(b2)
+		}
+		c.replace(false)
+	}
+
+	c.items[key] = c.lists[t1].PushFront(&arcEntry{key: key, value: value, list: t1})
+}
+
+// replace evicts an entry from t1 or t2 to its ghost list when the cache is full.
+func (c *arcCache) replace(inB2 bool) {
+	if c.len(t1)+c.len(t2) < c.cap {
+		return
+	}
+
+	from, to := t2, b2
+	if n := c.len(t1); n > 0 && (n > c.p || inB2 && n == c.p) {
+		from, to = t1, b1
+	}
+	el := c.lists[from].Back()
+	el.Value.(*arcEntry).value = 0
+	c.move(el, to)
+}
+
+func (c *arcCache) Range(f func(key, value int) bool) {
+	for _, l := range []arcList{t1, t2} {
+		for el := c.lists[l].Back(); el != nil; el = el.Prev() {
+			e := el.Value.(*arcEntry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *arcCache) Clear() {
+	c.p = 0
+	clear(c.items)
+	for _, l := range c.lists {
+		l.Init()
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !solution
+
+// Package cache implements a concurrent LRU cache with keys and values of any type.
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+type Cache[K comparable, V any] interface {
+	// Get returns value associated with the key and updates its access time.
+	//
+	// The second value is a bool that is true if the key exists in the cache,
+	// and false if not.
+	Get(key K) (V, bool)
+	// Peek is Get that keeps the access time of the key.
+	Peek(key K) (V, bool)
+	// Set updates value associated with the key, the entry expires after
+	// the default TTL of the cache.
+	Set(key K, value V)
+	// SetWithTTL is Set with the TTL of the entry, zero ttl means no expiration.
+	SetWithTTL(key K, value V, ttl time.Duration)
+	// Delete removes the key, it returns false if there is no such key.
+	Delete(key K) bool
+	// Len returns the number of entries, including the expired
+	// ones which are not removed yet.
+	Len() int
+	// Range calls function f on all unexpired elements of the cache
+	// in increasing access time order.
+	//
+	// Stops earlier if f returns false.
+	Range(f func(key K, value V) bool)
+	// Clear removes all keys and values from the cache.
+	Clear()
+}
+
+// EvictReason tells why an entry left the cache.
+type EvictReason int
+
+const (
+	// Capacity means the entry was least recently used in a full cache.
+	Capacity EvictReason = iota
+	// Expired means the TTL of the entry passed.
+	Expired
+	// Deleted means the entry was removed by Delete.
+	Deleted
+	// Cleared means the entry was removed by Clear.
+	Cleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Capacity:
+		return "capacity"
+	case Expired:
+		return "expired"
+	case Deleted:
+		return "deleted"
+	case Cleared:
+		return "cleared"
+	default:
+		return fmt.Sprintf("EvictReason(%d)", int(r))
+	}
+}
+
+// Option configures a cache.
+type Option func(*options)
+
+type options struct {
+	shards          int
+	ttl             time.Duration
+	cleanupInterval time.Duration
+	now             func() time.Time
+	// onEvict is func(K, V, EvictReason) of the cache
+	onEvict any
+	// cost is func(K, V) int64 of the cache
+	cost any
+}
+
+// WithShards splits the cache into n independently locked parts. Every part
+// evicts its own least recently used entries, so with several shards the
+// eviction order is approximate. By default large caches have 16 shards.
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// WithTTL sets the TTL of entries added by Set.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithCleanupInterval makes the cache remove expired entries in background
+// every interval, otherwise they are removed when accessed or evicted.
+// The cache has to be closed to stop the cleanup.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.cleanupInterval = interval
+	}
+}
+
+// WithClock replaces time.Now for TTL.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithOnEvict calls f for every entry leaving the cache, except for updated values.
+// f is called without locks held, so it may use the cache.
+func WithOnEvict[K comparable, V any](f func(key K, value V, reason EvictReason)) Option {
+	return func(o *options) {
+		o.onEvict = f
+	}
+}
+
+// WithCost computes the cost of entries added by Set and SetWithTTL.
+// The cost must not be negative.
+func WithCost[K comparable, V any](f func(key K, value V) int64) Option {
+	return func(o *options) {
+		o.cost = f
+	}
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func keys[K comparable, V any](c Cache[K, V]) []K {
+	var keys []K
+	c.Range(func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestLRU(t *testing.T) {
+	var evicted []eviction[string, int]
+	c := New[string, int](3, WithShards(1), WithOnEvict(func(key string, value int, reason EvictReason) {
+		evicted = append(evicted, eviction[string, int]{key, value, reason})
+	}))
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+
+	c.Set("d", 4)
+	require.Equal(t, []string{"c", "a", "d"}, keys[string, int](c))
+	require.Equal(t, []eviction[string, int]{{"b", 2, Capacity}}, evicted)
+
+	c.Set("c", 30)
+	require.Equal(t, []string{"a", "d", "c"}, keys[string, int](c))
+	require.Equal(t, 3, c.Len())
+
+	require.True(t, c.Delete("a"))
+	require.False(t, c.Delete("a"))
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 2, c.Len())
+
+	c.Clear()
+	require.Zero(t, c.Len())
+	require.Equal(t, []eviction[string, int]{
+		{"b", 2, Capacity},
+		{"a", 1, Deleted},
+		{"d", 4, Cleared},
+		{"c", 30, Cleared},
+	}, evicted)
+}
+
+func TestLRU_TTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var evicted []eviction[string, int]
+	c := New[string, int](10, WithTTL(time.Minute), WithClock(clock.Now),
+		WithOnEvict(func(key string, value int, reason EvictReason) {
+			evicted = append(evicted, eviction[string, int]{key, value, reason})
+		}))
+
+	c.Set("default", 1)
+	c.SetWithTTL("short", 2, time.Second)
+	c.SetWithTTL("forever", 3, 0)
+
+	clock.Advance(time.Second)
+	_, ok := c.Peek("short")
+	require.False(t, ok)
+	require.Equal(t, []eviction[string, int]{{"short", 2, Expired}}, evicted)
+
+	clock.Advance(time.Minute)
+	require.Equal(t, []string{"forever"}, keys[string, int](c))
+	require.Equal(t, 2, c.Len())
+
+	c.RemoveExpired()
+	require.Equal(t, 1, c.Len())
+	require.Equal(t, eviction[string, int]{"default", 1, Expired}, evicted[1])
+
+	v, ok := c.Get("forever")
+	require.True(t, ok)
+	require.Equal(t, 3, v)
+}
+
+func TestLRU_Cleanup(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	expired := make(chan string, 1)
+	c := New[string, int](10, WithCleanupInterval(time.Millisecond),
+		WithOnEvict(func(key string, value int, reason EvictReason) {
+			expired <- key
+		}))
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, 10*time.Millisecond)
+	require.Equal(t, "a", <-expired)
+	require.Zero(t, c.Len())
+}
+
+func TestLRU_Shards(t *testing.T) {
+	c := New[int, int](1000, WithShards(4))
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+	c.Get(0)
+
+	expected := make([]int, 0, 100)
+	for i := 1; i < 100; i++ {
+		expected = append(expected, i)
+	}
+	require.Equal(t, append(expected, 0), keys[int, int](c))
+
+	for i := 100; i < 2000; i++ {
+		c.Set(i, i)
+	}
+	require.LessOrEqual(t, c.Len(), 1000)
+	require.Greater(t, c.Len(), 900)
+}
+
+func TestLRU_Concurrent(t *testing.T) {
+	c := New[string, int](100)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprint(i % 150)
+				c.Set(key, i)
+				if v, ok := c.Get(key); ok {
+					require.Equal(t, key, fmt.Sprint(v%150))
+				}
+				if i%100 == 0 {
+					c.Delete(key)
+					c.Range(func(key string, value int) bool { return true })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, c.Len(), 100)
+}
+
+func TestLRU_OnEvictType(t *testing.T) {
+	require.Panics(t, func() {
+		New[string, int](1, WithOnEvict(func(key int, value int, reason EvictReason) {}))
+	})
+}
+
+func TestLRU_Cost(t *testing.T) {
+	var evicted []eviction[string, int]
+	c := NewWithCost[string, []byte](10,
+		WithCost(func(key string, value []byte) int64 { return int64(len(value)) }),
+		WithOnEvict(func(key string, value []byte, reason EvictReason) {
+			evicted = append(evicted, eviction[string, int]{key, len(value), reason})
+		}))
+
+	c.Set("a", make([]byte, 4))
+	c.Set("b", make([]byte, 4))
+	c.Set("c", make([]byte, 2))
+	require.Equal(t, int64(10), c.Cost())
+
+	c.Get("a")
+	c.Set("d", make([]byte, 5))
+	require.Equal(t, []string{"a", "d"}, keys[string, []byte](c))
+	require.Equal(t, int64(9), c.Cost())
+	require.Equal(t, []eviction[string, int]{{"b", 4, Capacity}, {"c", 2, Capacity}}, evicted)
+
+	require.False(t, c.SetWithCost("big", nil, 11))
+	require.False(t, c.SetWithCost("a", nil, 11))
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, int64(5), c.Cost())
+
+	require.True(t, c.SetWithCost("d", nil, 10))
+	require.True(t, c.SetWithCost("e", nil, 0))
+	require.Equal(t, []string{"d", "e"}, keys[string, []byte](c))
+
+	require.True(t, c.SetWithCost("e", nil, 3))
+	require.Equal(t, []string{"e"}, keys[string, []byte](c))
+	require.Equal(t, int64(3), c.Cost())
+
+	require.Panics(t, func() { c.SetWithCost("f", nil, -1) })
+}
+
+func TestLRU_Stats(t *testing.T) {
+	c := New[int, int](2)
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	c.Set(3, 3)
+	c.Get(1)
+	c.Get(2)
+	c.Get(3)
+	c.Peek(2)
+	c.Delete(3)
+	require.False(t, c.SetWithCost(4, 4, 3))
+
+	stats := c.Stats()
+	require.Equal(t, Stats{Hits: 2, Misses: 1, Evictions: 1, Rejections: 1}, stats)
+	require.InDelta(t, 2.0/3, stats.HitRatio(), 1e-9)
+}
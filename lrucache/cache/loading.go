@@ -0,0 +1,190 @@
+//go:build !solution
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrLoaderPanic is returned by Get when the loader panics.
+var ErrLoaderPanic = errors.New("cache: loader panicked")
+
+// negativeCacheSize bounds the number of remembered load errors.
+const negativeCacheSize = 1024
+
+// Loader returns the value of a key missing in the cache.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadingOption configures a LoadingCache.
+type LoadingOption func(*loadingOptions)
+
+type loadingOptions struct {
+	negativeTTL  time.Duration
+	refreshAhead time.Duration
+}
+
+// WithNegativeTTL makes Get return the error of a failed load for ttl
+// instead of loading the key again.
+func WithNegativeTTL(ttl time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithRefreshAhead makes Get of an entry expiring within d reload it
+// in background, while Get keeps returning the cached value.
+func WithRefreshAhead(d time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.refreshAhead = d
+	}
+}
+
+// call is a load of a key shared by concurrent Get calls.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+
+	// waiters is the number of Get calls waiting for the load,
+	// the load is canceled when all of them are canceled
+	waiters int
+	refresh bool
+	cancel  context.CancelFunc
+}
+
+// LoadingCache loads missing keys into a cache, a key is loaded once
+// however many goroutines get it concurrently.
+type LoadingCache[K comparable, V any] struct {
+	cache        *LRU[K, V]
+	failures     *LRU[K, error]
+	refreshAhead time.Duration
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+// NewLoadingCache returns a LoadingCache storing values in c,
+// loaded values expire after the TTL of c.
+func NewLoadingCache[K comparable, V any](c *LRU[K, V], opts ...LoadingOption) *LoadingCache[K, V] {
+	var o loadingOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	l := &LoadingCache[K, V]{
+		cache:        c,
+		refreshAhead: o.refreshAhead,
+		calls:        make(map[K]*call[V]),
+	}
+	if o.negativeTTL > 0 {
+		l.failures = New[K, error](negativeCacheSize, WithTTL(o.negativeTTL), WithClock(c.now))
+	}
+	return l
+}
+
+// Get returns the cached value of the key or loads it with loader.
+//
+// The load runs in background with the values of ctx, it is canceled
+// when all Get calls waiting for it are canceled.
+func (l *LoadingCache[K, V]) Get(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	if value, expires, ok := l.cache.get(key, true); ok {
+		l.cache.stats.hits.Add(1)
+		if l.refreshAhead > 0 && expires != 0 && l.cache.now().Add(l.refreshAhead).UnixNano() >= expires {
+			l.load(ctx, key, loader, true)
+		}
+		return value, nil
+	}
+	l.cache.stats.misses.Add(1)
+
+	var zero V
+	if l.failures != nil {
+		if err, ok := l.failures.Get(key); ok {
+			return zero, err
+		}
+	}
+
+	c := l.load(ctx, key, loader, false)
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		l.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && !c.refresh {
+			// the next Get starts a new load instead of joining the canceled one
+			l.forget(key, c)
+			c.cancel()
+		}
+		l.mu.Unlock()
+		return zero, ctx.Err()
+	}
+}
+
+// load joins the load of the key or starts a new one. Refreshes are
+// not waited for and are not canceled.
+func (l *LoadingCache[K, V]) load(ctx context.Context, key K, loader Loader[K, V], refresh bool) *call[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.calls[key]
+	if !ok {
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), refresh: refresh, cancel: cancel}
+		l.calls[key] = c
+		go l.run(loadCtx, key, loader, c)
+	}
+	if !refresh {
+		c.waiters++
+	}
+	return c
+}
+
+func (l *LoadingCache[K, V]) run(ctx context.Context, key K, loader Loader[K, V], c *call[V]) {
+	defer func() {
+		l.mu.Lock()
+		l.forget(key, c)
+		l.mu.Unlock()
+
+		c.cancel()
+		close(c.done)
+	}()
+
+	c.value, c.err = safeLoad(ctx, key, loader)
+
+	switch {
+	case ctx.Err() != nil:
+		// all callers are gone and a new load may have replaced this one,
+		// neither the value nor the error is worth keeping
+	case c.err == nil:
+		l.cache.Set(key, c.value)
+		if l.failures != nil {
+			l.failures.Delete(key)
+		}
+	case l.failures != nil && !c.refresh:
+		l.failures.Set(key, c.err)
+	}
+}
+
+// safeLoad calls loader, a panic becomes an error wrapping ErrLoaderPanic
+// as nothing could recover it in the goroutine of the load.
+func safeLoad[K comparable, V any](ctx context.Context, key K, loader Loader[K, V]) (value V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n\n%s", ErrLoaderPanic, r, debug.Stack())
+		}
+	}()
+	return loader(ctx, key)
+}
+
+// forget removes c from the loads in progress unless a new load
+// of the key replaced it. l.mu must be held.
+func (l *LoadingCache[K, V]) forget(key K, c *call[V]) {
+	if l.calls[key] == c {
+		delete(l.calls, key)
+	}
+}
@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestLoadingCache(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoadingCache(New[string, int](10))
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (int, error) {
+		calls.Add(1)
+		<-release
+		return len(key), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get(context.Background(), "key", loader)
+			require.NoError(t, err)
+			require.Equal(t, 3, v)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	v, err := c.Get(context.Background(), "key", loader)
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestLoadingCache_NegativeTTL(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewLoadingCache(New[string, int](10, WithClock(clock.Now)), WithNegativeTTL(time.Second))
+
+	errLoad := errors.New("load failed")
+	calls := 0
+	loader := func(ctx context.Context, key string) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errLoad
+		}
+		return 42, nil
+	}
+
+	_, err := c.Get(context.Background(), "key", loader)
+	require.ErrorIs(t, err, errLoad)
+	_, err = c.Get(context.Background(), "key", loader)
+	require.ErrorIs(t, err, errLoad)
+	require.Equal(t, 1, calls)
+
+	clock.Advance(time.Second)
+	v, err := c.Get(context.Background(), "key", loader)
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+	require.Equal(t, 2, calls)
+}
+
+func TestLoadingCache_Cancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoadingCache(New[string, int](10), WithNegativeTTL(time.Minute))
+
+	started := make(chan struct{}, 1)
+	loader := func(ctx context.Context, key string) (int, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Get(ctx, "key", loader)
+			errs <- err
+		}()
+	}
+
+	<-started
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+	require.ErrorIs(t, <-errs, context.Canceled)
+
+	// the canceled load is not cached as a failure
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.calls) == 0
+	}, time.Second, time.Millisecond)
+	v, err := c.Get(context.Background(), "key", func(ctx context.Context, key string) (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+}
+
+func TestLoadingCache_GetAfterCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoadingCache(New[string, int](10))
+
+	// the canceled load ignores its context and finishes late
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stale := func(ctx context.Context, key string) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, "key", stale)
+		canceled <- err
+	}()
+	<-started
+	c.mu.Lock()
+	old := c.calls["key"]
+	c.mu.Unlock()
+	cancel()
+	require.ErrorIs(t, <-canceled, context.Canceled)
+
+	fresh := make(chan struct{})
+	result := make(chan int)
+	go func() {
+		v, err := c.Get(context.Background(), "key", func(ctx context.Context, key string) (int, error) {
+			<-fresh
+			return 2, ctx.Err()
+		})
+		require.NoError(t, err)
+		result <- v
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.calls["key"] != nil
+	}, time.Second, time.Millisecond)
+
+	// the stale load neither drops the new one nor stores its value
+	close(release)
+	<-old.done
+	c.mu.Lock()
+	require.NotNil(t, c.calls["key"])
+	require.NotSame(t, old, c.calls["key"])
+	c.mu.Unlock()
+	_, ok := c.cache.Get("key")
+	require.False(t, ok)
+
+	close(fresh)
+	require.Equal(t, 2, <-result)
+}
+
+func TestLoadingCache_Panic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoadingCache(New[string, int](10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Get(context.Background(), "key", func(ctx context.Context, key string) (int, error) {
+				time.Sleep(10 * time.Millisecond)
+				panic("boom")
+			})
+			require.ErrorIs(t, err, ErrLoaderPanic)
+			require.ErrorContains(t, err, "boom")
+		}()
+	}
+	wg.Wait()
+
+	v, err := c.Get(context.Background(), "key", func(ctx context.Context, key string) (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+}
+
+func TestLoadingCache_CancelOne(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoadingCache(New[string, int](10))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, "key", loader)
+		canceled <- err
+	}()
+	<-started
+
+	result := make(chan int)
+	go func() {
+		v, err := c.Get(context.Background(), "key", loader)
+		require.NoError(t, err)
+		result <- v
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.calls["key"].waiters == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-canceled, context.Canceled)
+
+	close(release)
+	require.Equal(t, 1, <-result)
+}
+
+func TestLoadingCache_RefreshAhead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewLoadingCache(New[string, int](10, WithTTL(time.Minute), WithClock(clock.Now)),
+		WithRefreshAhead(10*time.Second))
+
+	var version atomic.Int32
+	loaded := make(chan struct{}, 1)
+	loader := func(ctx context.Context, key string) (int, error) {
+		defer func() { loaded <- struct{}{} }()
+		return int(version.Add(1)), nil
+	}
+
+	get := func() int {
+		v, err := c.Get(context.Background(), "key", loader)
+		require.NoError(t, err)
+		return v
+	}
+
+	require.Equal(t, 1, get())
+	<-loaded
+
+	clock.Advance(45 * time.Second)
+	require.Equal(t, 1, get())
+
+	clock.Advance(10 * time.Second)
+	require.Equal(t, 1, get())
+	<-loaded
+	require.Eventually(t, func() bool {
+		v, _ := c.cache.Peek("key")
+		return v == 2
+	}, time.Second, time.Millisecond)
+
+	clock.Advance(30 * time.Second)
+	require.Equal(t, 2, get())
+}
@@ -0,0 +1,441 @@
+//go:build !solution
+
+package cache
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultShards = 16
+	// minShardCap keeps small caches from being split by default,
+	// eviction in tiny shards is far from LRU
+	minShardCap = 64
+	// maxPrealloc bounds the map size allocated in advance,
+	// the budget of cost caches is usually not a number of entries
+	maxPrealloc = 1 << 16
+)
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	// expires is the expiration time in unix nanoseconds, zero means never
+	expires int64
+	cost    int64
+	// stamp orders accesses across shards
+	stamp uint64
+}
+
+// shard keeps entries in a list from the most to the least recently used,
+// the map points into the list, so every operation is O(1).
+type shard[K comparable, V any] struct {
+	mu      sync.Mutex
+	maxCost int64
+	cost    int64
+	items   map[K]*list.Element
+	order   *list.List
+}
+
+func (s *shard[K, V]) remove(el *list.Element) *entry[K, V] {
+	e := s.order.Remove(el).(*entry[K, V])
+	delete(s.items, e.key)
+	s.cost -= e.cost
+	return e
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// LRU is a concurrent least recently used cache.
+type LRU[K comparable, V any] struct {
+	shards  []shard[K, V]
+	seed    maphash.Seed
+	ttl     time.Duration
+	now     func() time.Time
+	onEvict func(key K, value V, reason EvictReason)
+	cost    func(key K, value V) int64
+	stamp   atomic.Uint64
+	stats   stats
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var _ Cache[int, int] = (*LRU[int, int])(nil)
+
+// New returns a cache holding up to cap entries.
+func New[K comparable, V any](cap int, opts ...Option) *LRU[K, V] {
+	return newLRU[K, V](int64(cap), min(defaultShards, cap/minShardCap), opts)
+}
+
+// NewWithCost returns a cache holding entries of total cost up to maxCost.
+// The cost of entries is given to SetWithCost or computed by the function
+// of WithCost, by default every entry costs 1. The cache has one shard
+// unless WithShards is given, shards split the budget.
+func NewWithCost[K comparable, V any](maxCost int64, opts ...Option) *LRU[K, V] {
+	return newLRU[K, V](maxCost, 1, opts)
+}
+
+func newLRU[K comparable, V any](maxCost int64, shards int, opts []Option) *LRU[K, V] {
+	o := options{shards: shards, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	n := int(max(min(int64(o.shards), maxCost), 1))
+	c := &LRU[K, V]{
+		shards: make([]shard[K, V], n),
+		seed:   maphash.MakeSeed(),
+		ttl:    o.ttl,
+		now:    o.now,
+		done:   make(chan struct{}),
+	}
+	if o.onEvict != nil {
+		f, ok := o.onEvict.(func(K, V, EvictReason))
+		if !ok {
+			panic(fmt.Sprintf("cache: OnEvict callback %T does not match cache of %T", o.onEvict, c))
+		}
+		c.onEvict = f
+	}
+	if o.cost != nil {
+		f, ok := o.cost.(func(K, V) int64)
+		if !ok {
+			panic(fmt.Sprintf("cache: cost function %T does not match cache of %T", o.cost, c))
+		}
+		c.cost = f
+	}
+
+	for i := range c.shards {
+		shardCost := maxCost / int64(n)
+		if int64(i) < maxCost%int64(n) {
+			shardCost++
+		}
+		c.shards[i] = shard[K, V]{
+			maxCost: shardCost,
+			items:   make(map[K]*list.Element, min(shardCost, maxPrealloc)),
+			order:   list.New(),
+		}
+	}
+
+	if o.cleanupInterval > 0 {
+		c.wg.Add(1)
+		go c.cleanup(o.cleanupInterval)
+	}
+	return c
+}
+
+func (c *LRU[K, V]) shard(key K) *shard[K, V] {
+	if len(c.shards) == 1 {
+		return &c.shards[0]
+	}
+	return &c.shards[maphash.Comparable(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *LRU[K, V]) expired(e *entry[K, V]) bool {
+	return e.expires != 0 && c.now().UnixNano() >= e.expires
+}
+
+func (c *LRU[K, V]) evict(key K, value V, reason EvictReason) {
+	if reason == Capacity || reason == Expired {
+		c.stats.evictions.Add(1)
+	}
+	if c.onEvict != nil {
+		c.onEvict(key, value, reason)
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	value, _, ok := c.get(key, true)
+	if ok {
+		c.stats.hits.Add(1)
+	} else {
+		c.stats.misses.Add(1)
+	}
+	return value, ok
+}
+
+func (c *LRU[K, V]) Peek(key K) (V, bool) {
+	value, _, ok := c.get(key, false)
+	return value, ok
+}
+
+// get returns the value with its expiration time in unix nanoseconds.
+func (c *LRU[K, V]) get(key K, touch bool) (value V, expires int64, ok bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+
+	el, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		return value, 0, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if c.expired(e) {
+		s.remove(el)
+		s.mu.Unlock()
+		c.evict(e.key, e.value, Expired)
+		return value, 0, false
+	}
+
+	if touch {
+		e.stamp = c.stamp.Add(1)
+		s.order.MoveToFront(el)
+	}
+	value, expires = e.value, e.expires
+	s.mu.Unlock()
+	return value, expires, true
+}
+
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *LRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	cost := int64(1)
+	if c.cost != nil {
+		cost = c.cost(key, value)
+	}
+	c.set(key, value, ttl, cost)
+}
+
+// SetWithCost is Set of an entry with the given cost. It returns false
+// and removes the key if the cost exceeds the budget of the cache.
+func (c *LRU[K, V]) SetWithCost(key K, value V, cost int64) bool {
+	return c.set(key, value, c.ttl, cost)
+}
+
+func (c *LRU[K, V]) set(key K, value V, ttl time.Duration, cost int64) bool {
+	if cost < 0 {
+		panic(fmt.Sprintf("cache: negative cost %d", cost))
+	}
+
+	var expires int64
+	if ttl > 0 {
+		expires = c.now().Add(ttl).UnixNano()
+	}
+
+	// evictions are reported after unlock, the buffer keeps
+	// the common case of a single eviction off the heap
+	var buf [4]eviction[K, V]
+	evicted := buf[:0]
+	defer func() {
+		for _, ev := range evicted {
+			c.evict(ev.key, ev.value, ev.reason)
+		}
+	}()
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if cost > s.maxCost {
+		c.stats.rejections.Add(1)
+		if ok {
+			e := s.remove(el)
+			evicted = append(evicted, eviction[K, V]{e.key, e.value, Capacity})
+		}
+		return false
+	}
+
+	if ok {
+		e := el.Value.(*entry[K, V])
+		s.cost += cost - e.cost
+		e.value, e.expires, e.cost, e.stamp = value, expires, cost, c.stamp.Add(1)
+		s.order.MoveToFront(el)
+		// the updated entry is at the front and fits, so it stays
+		for s.cost > s.maxCost {
+			evicted = c.evictBack(s, evicted)
+		}
+		return true
+	}
+
+	// the last evicted element is reused for the new entry, so a full cache
+	// of entries of equal cost does not allocate
+	var reused *list.Element
+	for s.cost+cost > s.maxCost {
+		back := s.order.Back()
+		if e := back.Value.(*entry[K, V]); s.cost-e.cost+cost <= s.maxCost {
+			evicted = append(evicted, eviction[K, V]{e.key, e.value, c.reason(e)})
+			delete(s.items, e.key)
+			s.cost -= e.cost
+			reused = back
+			break
+		}
+		evicted = c.evictBack(s, evicted)
+	}
+
+	e := entry[K, V]{key: key, value: value, expires: expires, cost: cost, stamp: c.stamp.Add(1)}
+	if reused != nil {
+		*reused.Value.(*entry[K, V]) = e
+		s.order.MoveToFront(reused)
+		s.items[key] = reused
+	} else {
+		added := e
+		s.items[key] = s.order.PushFront(&added)
+	}
+	s.cost += cost
+	return true
+}
+
+func (c *LRU[K, V]) reason(e *entry[K, V]) EvictReason {
+	if c.expired(e) {
+		return Expired
+	}
+	return Capacity
+}
+
+func (c *LRU[K, V]) evictBack(s *shard[K, V], evicted []eviction[K, V]) []eviction[K, V] {
+	e := s.remove(s.order.Back())
+	return append(evicted, eviction[K, V]{e.key, e.value, c.reason(e)})
+}
+
+func (c *LRU[K, V]) Delete(key K) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+
+	el, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	e := s.remove(el)
+	s.mu.Unlock()
+
+	c.evict(e.key, e.value, Deleted)
+	return true
+}
+
+func (c *LRU[K, V]) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += s.order.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Cost returns the total cost of entries, including the expired ones
+// which are not removed yet.
+func (c *LRU[K, V]) Cost() int64 {
+	var cost int64
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		cost += s.cost
+		s.mu.Unlock()
+	}
+	return cost
+}
+
+// Stats returns the counters of the cache since its creation.
+func (c *LRU[K, V]) Stats() Stats {
+	return c.stats.load()
+}
+
+// Range iterates over a snapshot of the cache, so f may use the cache.
+func (c *LRU[K, V]) Range(f func(key K, value V) bool) {
+	var entries []entry[K, V]
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for el := s.order.Back(); el != nil; el = el.Prev() {
+			if e := el.Value.(*entry[K, V]); !c.expired(e) {
+				entries = append(entries, *e)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	if len(c.shards) > 1 {
+		slices.SortFunc(entries, func(a, b entry[K, V]) int {
+			return cmp.Compare(a.stamp, b.stamp)
+		})
+	}
+
+	for _, e := range entries {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+func (c *LRU[K, V]) Clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		order := s.order
+		clear(s.items)
+		s.order = list.New()
+		s.cost = 0
+		s.mu.Unlock()
+
+		if c.onEvict != nil {
+			for el := order.Back(); el != nil; el = el.Prev() {
+				e := el.Value.(*entry[K, V])
+				c.onEvict(e.key, e.value, Cleared)
+			}
+		}
+	}
+}
+
+// RemoveExpired removes all expired entries, the cache calls it in background
+// when created with WithCleanupInterval.
+func (c *LRU[K, V]) RemoveExpired() {
+	var expired []*entry[K, V]
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for el := s.order.Back(); el != nil; {
+			prev := el.Prev()
+			if c.expired(el.Value.(*entry[K, V])) {
+				expired = append(expired, s.remove(el))
+			}
+			el = prev
+		}
+		s.mu.Unlock()
+
+		for _, e := range expired {
+			c.evict(e.key, e.value, Expired)
+		}
+		expired = expired[:0]
+	}
+}
+
+func (c *LRU[K, V]) cleanup(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.RemoveExpired()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the background cleanup, the cache stays usable.
+func (c *LRU[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+}
@@ -0,0 +1,37 @@
+//go:build !solution
+
+package cache
+
+import "sync/atomic"
+
+// Stats counts the operations of a cache.
+type Stats struct {
+	// Hits and Misses count calls of Get.
+	Hits   uint64
+	Misses uint64
+	// Evictions counts entries removed because of the capacity or TTL.
+	Evictions uint64
+	// Rejections counts entries not added because their cost exceeds the budget.
+	Rejections uint64
+}
+
+// HitRatio returns the share of Get calls which found the key.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type stats struct {
+	hits, misses, evictions, rejections atomic.Uint64
+}
+
+func (s *stats) load() Stats {
+	return Stats{
+		Hits:       s.hits.Load(),
+		Misses:     s.misses.Load(),
+		Evictions:  s.evictions.Load(),
+		Rejections: s.rejections.Load(),
+	}
+}
@@ -9,89 +9,144 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+type policy struct {
+	name string
+	new  func(cap int) Cache
+	// recency is true if only Set of new keys keeps the keys in insertion order
+	recency bool
+}
+
+var policies = []policy{
+	{name: "LRU", new: New, recency: true},
+	{name: "LFU", new: NewLFU},
+	{name: "ARC", new: NewARC},
+	{name: "TinyLFU", new: NewTinyLFU},
+}
+
+func forEachPolicy(t *testing.T, f func(t *testing.T, p policy)) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			f(t, p)
+		})
+	}
+}
+
 func TestCache_empty(t *testing.T) {
-	c := New(0)
+	forEachPolicy(t, func(t *testing.T, p policy) {
+		c := p.new(0)
 
-	c.Set(1, 2)
-	_, ok := c.Get(1)
-	require.False(t, ok)
+		c.Set(1, 2)
+		_, ok := c.Get(1)
+		require.False(t, ok)
+	})
 }
 
 func TestCache_update(t *testing.T) {
-	c := New(1)
+	forEachPolicy(t, func(t *testing.T, p policy) {
+		c := p.new(1)
 
-	_, ok := c.Get(1)
-	require.False(t, ok)
+		_, ok := c.Get(1)
+		require.False(t, ok)
 
-	c.Set(1, 2)
-	v, ok := c.Get(1)
-	require.True(t, ok)
-	require.Equal(t, 2, v)
+		c.Set(1, 2)
+		v, ok := c.Get(1)
+		require.True(t, ok)
+		require.Equal(t, 2, v)
+	})
 }
 
 func TestCache_Get(t *testing.T) {
-	c := New(5)
-
-	for i := 0; i < 5; i++ {
-		c.Set(i, i)
+	expected := map[string][]int{
+		"LRU": {4, 0, 1, 5, 6},
+		// 0 and 1 are used twice
+		"LFU": {4, 5, 6, 0, 1},
+		"ARC": {4, 5, 6, 0, 1},
+		// 4 and 5 are not admitted, they are not used more often than 2
+		"TinyLFU": {6, 2, 3, 0, 1},
 	}
 
-	c.Get(0)
-	c.Get(1)
+	forEachPolicy(t, func(t *testing.T, p policy) {
+		c := p.new(5)
+
+		for i := 0; i < 5; i++ {
+			c.Set(i, i)
+		}
+
+		c.Get(0)
+		c.Get(1)
 
-	c.Set(5, 5)
-	c.Set(6, 6)
+		c.Set(5, 5)
+		c.Set(6, 6)
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return true
+		var keys, values []int
+		c.Range(func(key, value int) bool {
+			keys = append(keys, key)
+			values = append(values, value)
+			return true
+		})
+		require.Equal(t, expected[p.name], keys)
+		require.Equal(t, expected[p.name], values)
 	})
-	require.Equal(t, []int{4, 0, 1, 5, 6}, keys)
-	require.Equal(t, []int{4, 0, 1, 5, 6}, values)
 }
 
 func TestCache_Clear(t *testing.T) {
-	c := New(5)
-
-	for i := 0; i < 10; i++ {
-		c.Set(i, i)
+	expected := map[string][]int{
+		"LRU":     {4, 3, 2, 1, 0},
+		"LFU":     {4, 3, 2, 1, 0},
+		"ARC":     {4, 3, 2, 1, 0},
+		"TinyLFU": {0, 9, 8, 7, 6},
 	}
 
-	c.Clear()
+	forEachPolicy(t, func(t *testing.T, p policy) {
+		c := p.new(5)
 
-	for i := 9; i >= 0; i-- {
-		c.Set(i, i)
-	}
+		for i := 0; i < 10; i++ {
+			c.Set(i, i)
+		}
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return true
-	})
+		c.Clear()
 
-	require.Equal(t, []int{4, 3, 2, 1, 0}, keys)
-	require.Equal(t, []int{4, 3, 2, 1, 0}, values)
+		for i := 9; i >= 0; i-- {
+			c.Set(i, i)
+		}
+
+		var keys, values []int
+		c.Range(func(key, value int) bool {
+			keys = append(keys, key)
+			values = append(values, value)
+			return true
+		})
+
+		require.Equal(t, expected[p.name], keys)
+		require.Equal(t, expected[p.name], values)
+	})
 }
 
 func TestCache_Range(t *testing.T) {
-	c := New(5)
-
-	for i := 0; i < 10; i++ {
-		c.Set(i, i)
+	expected := map[string][]int{
+		"LRU":     {5, 6, 7, 8},
+		"LFU":     {5, 6, 7, 8},
+		"ARC":     {5, 6, 7, 8},
+		"TinyLFU": {9, 0, 1, 2},
 	}
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return key < 8
-	})
+	forEachPolicy(t, func(t *testing.T, p policy) {
+		c := p.new(5)
+
+		for i := 0; i < 10; i++ {
+			c.Set(i, i)
+		}
 
-	require.Equal(t, []int{5, 6, 7, 8}, keys)
-	require.Equal(t, []int{5, 6, 7, 8}, values)
+		var keys, values []int
+		c.Range(func(key, value int) bool {
+			keys = append(keys, key)
+			values = append(values, value)
+			return len(keys) < 4
+		})
+
+		require.Equal(t, expected[p.name], keys)
+		require.Equal(t, expected[p.name], values)
+	})
 }
 
 func TestCache_eviction(t *testing.T) {
@@ -123,35 +178,39 @@ func TestCache_eviction(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			c := New(tc.cap)
+			forEachPolicy(t, func(t *testing.T, p policy) {
+				c := p.new(tc.cap)
 
-			keyToValue := make(map[int]int)
-			for i := 0; i < tc.numInserts; i++ {
-				key := int(r.Int31n(tc.maxKey))
-				c.Set(key, i)
-				keyToValue[key] = i
-			}
+				keyToValue := make(map[int]int)
+				for i := 0; i < tc.numInserts; i++ {
+					key := int(r.Int31n(tc.maxKey))
+					c.Set(key, i)
+					keyToValue[key] = i
+				}
 
-			var keys, values []int
-			c.Range(func(key, value int) bool {
-				require.Equal(t, keyToValue[key], value)
-				keys = append(keys, key)
-				values = append(values, value)
-				return true
-			})
+				var keys, values []int
+				c.Range(func(key, value int) bool {
+					require.Equal(t, keyToValue[key], value)
+					keys = append(keys, key)
+					values = append(values, value)
+					return true
+				})
 
-			expectedLen := tc.cap
-			if len(keyToValue) < tc.cap {
-				expectedLen = len(keyToValue)
-			}
-			require.Len(t, values, expectedLen)
-			require.True(t, sort.IntsAreSorted(values), "values: %+v", values)
+				expectedLen := tc.cap
+				if len(keyToValue) < tc.cap {
+					expectedLen = len(keyToValue)
+				}
+				require.Len(t, values, expectedLen)
+				if p.recency {
+					require.True(t, sort.IntsAreSorted(values), "values: %+v", values)
+				}
 
-			for _, k := range keys {
-				v, ok := c.Get(k)
-				require.True(t, ok)
-				require.Equal(t, keyToValue[k], v)
-			}
+				for _, k := range keys {
+					v, ok := c.Get(k)
+					require.True(t, ok)
+					require.Equal(t, keyToValue[k], v)
+				}
+			})
 		})
 	}
 }
@@ -161,6 +220,20 @@ func TestCache_GCPercent(t *testing.T) {
 	require.Equal(t, p, 100)
 }
 
+func TestCache_SetAllocs(t *testing.T) {
+	c := New(100)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+
+	i := 0
+	allocs := testing.AllocsPerRun(1000, func() {
+		c.Set(i%1000, i)
+		i++
+	})
+	require.Zero(t, allocs)
+}
+
 func BenchmarkCache_Set(b *testing.B) {
 	for _, tc := range []struct {
 		name string
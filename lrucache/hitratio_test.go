@@ -0,0 +1,92 @@
+package lrucache
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	traceCap    = 1000
+	traceLength = 200000
+)
+
+// zipfTrace accesses keys with a Zipf distribution, a few keys are hot.
+func zipfTrace(r *rand.Rand, n int) []int {
+	z := rand.NewZipf(r, 1.1, 1, 100*traceCap)
+	trace := make([]int, n)
+	for i := range trace {
+		trace[i] = int(z.Uint64())
+	}
+	return trace
+}
+
+// loopTrace scans the same keys, twice as many as fit into the cache, in a loop.
+func loopTrace(n int) []int {
+	trace := make([]int, n)
+	for i := range trace {
+		trace[i] = i % (2 * traceCap)
+	}
+	return trace
+}
+
+// scanTrace is zipfTrace interrupted by scans of keys never seen again.
+func scanTrace(r *rand.Rand, n int) []int {
+	trace := zipfTrace(r, n)
+	next := -1
+	for i := range trace {
+		if i%(4*traceCap) < traceCap {
+			trace[i] = next
+			next--
+		}
+	}
+	return trace
+}
+
+var traces = []struct {
+	name  string
+	trace func() []int
+}{
+	{name: "zipf", trace: func() []int { return zipfTrace(rand.New(rand.NewSource(1)), traceLength) }},
+	{name: "loop", trace: func() []int { return loopTrace(traceLength) }},
+	{name: "zipf+scan", trace: func() []int { return scanTrace(rand.New(rand.NewSource(1)), traceLength) }},
+}
+
+// hitRatio replays the trace, setting keys on misses.
+func hitRatio(c Cache, trace []int) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Set(key, key)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestHitRatio_scan(t *testing.T) {
+	trace := scanTrace(rand.New(rand.NewSource(1)), traceLength)
+
+	lru := hitRatio(New(traceCap), trace)
+	for _, p := range policies[1:] {
+		require.Greater(t, hitRatio(p.new(traceCap), trace), lru, p.name)
+	}
+}
+
+func BenchmarkHitRatio(b *testing.B) {
+	for _, tr := range traces {
+		trace := tr.trace()
+		for _, p := range policies {
+			b.Run(tr.name+"/"+p.name, func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					ratio = hitRatio(p.new(traceCap), trace)
+				}
+				b.ReportMetric(100*ratio, "hit%")
+				b.ReportMetric(0, "ns/op")
+			})
+		}
+	}
+}
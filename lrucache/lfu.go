@@ -0,0 +1,109 @@
+//go:build !solution
+
+package lrucache
+
+import "container/list"
+
+type lfuEntry struct {
+	key, value int
+	bucket     *list.Element
+}
+
+// lfuBucket holds the entries accessed freq times, from the most
+// to the least recently used.
+type lfuBucket struct {
+	freq    int
+	entries *list.List
+}
+
+// lfuCache evicts the least frequently used entry, the least recently used
+// among equally frequent ones. Buckets are kept in increasing frequency
+// order, so every operation is O(1).
+type lfuCache struct {
+	cap     int
+	items   map[int]*list.Element
+	buckets *list.List
+}
+
+// NewLFU returns a least frequently used cache. Range visits entries
+// in eviction order: by increasing frequency, then by access time.
+func NewLFU(cap int) Cache {
+	return &lfuCache{
+		cap:     cap,
+		items:   make(map[int]*list.Element, cap),
+		buckets: list.New(),
+	}
+}
+
+func (c *lfuCache) Get(key int) (int, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+	c.touch(el)
+	return el.Value.(*lfuEntry).value, true
+}
+
+func (c *lfuCache) Set(key, value int) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lfuEntry).value = value
+		c.touch(el)
+		return
+	}
+	if c.cap <= 0 {
+		return
+	}
+
+	if len(c.items) == c.cap {
+		first := c.buckets.Front()
+		b := first.Value.(*lfuBucket)
+		e := b.entries.Remove(b.entries.Back()).(*lfuEntry)
+		delete(c.items, e.key)
+		if b.entries.Len() == 0 {
+			c.buckets.Remove(first)
+		}
+	}
+
+	first := c.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket).freq != 1 {
+		first = c.buckets.PushFront(&lfuBucket{freq: 1, entries: list.New()})
+	}
+	e := &lfuEntry{key: key, value: value, bucket: first}
+	c.items[key] = first.Value.(*lfuBucket).entries.PushFront(e)
+}
+
+// touch moves the entry to the bucket of the next frequency.
+func (c *lfuCache) touch(el *list.Element) {
+	e := el.Value.(*lfuEntry)
+	cur := e.bucket
+	b := cur.Value.(*lfuBucket)
+
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != b.freq+1 {
+		next = c.buckets.InsertAfter(&lfuBucket{freq: b.freq + 1, entries: list.New()}, cur)
+	}
+
+	b.entries.Remove(el)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(cur)
+	}
+	e.bucket = next
+	c.items[e.key] = next.Value.(*lfuBucket).entries.PushFront(e)
+}
+
+func (c *lfuCache) Range(f func(key, value int) bool) {
+	for b := c.buckets.Front(); b != nil; b = b.Next() {
+		entries := b.Value.(*lfuBucket).entries
+		for el := entries.Back(); el != nil; el = el.Prev() {
+			e := el.Value.(*lfuEntry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *lfuCache) Clear() {
+	clear(c.items)
+	c.buckets.Init()
+}
@@ -0,0 +1,73 @@
+//go:build !solution
+
+package lrucache
+
+import "math/bits"
+
+const (
+	sketchDepth    = 4
+	sketchMaxCount = 15
+	// sketchMinWidth keeps collisions of small caches rare
+	sketchMinWidth = 64
+)
+
+// sketch is a count-min sketch estimating access frequencies with
+// a few counters per key. Counters are halved after every resetAfter
+// increments, so the estimates follow recent accesses.
+type sketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	resetAfter int
+}
+
+func newSketch(cap int) *sketch {
+	width := uint64(1) << bits.Len(uint(max(cap, sketchMinWidth)-1))
+	s := &sketch{mask: width - 1, resetAfter: 10 * max(cap, 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index returns the counter of key in row i.
+func (s *sketch) index(key int, i int) uint64 {
+	// splitmix64 finalizer, seeded differently for every row
+	h := uint64(key) + uint64(i+1)*0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return (h ^ h>>31) & s.mask
+}
+
+func (s *sketch) increment(key int) {
+	for i := range s.rows {
+		if j := s.index(key, i); s.rows[i][j] < sketchMaxCount {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions == s.resetAfter {
+		s.additions /= 2
+		for _, row := range s.rows {
+			for j := range row {
+				row[j] /= 2
+			}
+		}
+	}
+}
+
+func (s *sketch) estimate(key int) uint8 {
+	n := uint8(sketchMaxCount)
+	for i := range s.rows {
+		n = min(n, s.rows[i][s.index(key, i)])
+	}
+	return n
+}
+
+func (s *sketch) clear() {
+	s.additions = 0
+	for _, row := range s.rows {
+		clear(row)
+	}
+}
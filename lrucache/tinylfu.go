@@ -0,0 +1,148 @@
+//go:build !solution
+
+package lrucache
+
+import "container/list"
+
+// segment is a part of the W-TinyLFU cache.
+type segment int
+
+const (
+	// window admits every new key.
+	window segment = iota
+	// probation holds keys admitted to the main cache.
+	probation
+	// protected holds keys accessed again while on probation.
+	protected
+)
+
+type tinyLFUEntry struct {
+	key, value int
+	segment    segment
+}
+
+// tinyLFUCache implements W-TinyLFU: new keys enter a small LRU window,
+// keys leaving the window replace the probation victim of the segmented
+// LRU main cache only if the sketch saw them more often. A scan passes
+// through the window without flushing frequently used keys.
+type tinyLFUCache struct {
+	cap      int
+	sizes    [3]int
+	segments [3]*list.List
+	items    map[int]*list.Element
+	sketch   *sketch
+}
+
+// NewTinyLFU returns a W-TinyLFU cache. The window takes 1% of cap, the rest
+// is split into 20% probation and 80% protected. Range visits the window,
+// then the probation and protected segments, each from least to most
+// recently used.
+func NewTinyLFU(cap int) Cache {
+	c := &tinyLFUCache{
+		cap:    cap,
+		items:  make(map[int]*list.Element, cap),
+		sketch: newSketch(cap),
+	}
+
+	c.sizes[window] = max(1, cap/100)
+	main := max(0, cap-c.sizes[window])
+	c.sizes[protected] = main * 8 / 10
+	c.sizes[probation] = main - c.sizes[protected]
+	for i := range c.segments {
+		c.segments[i] = list.New()
+	}
+	return c
+}
+
+func (c *tinyLFUCache) move(el *list.Element, to segment) {
+	e := c.segments[el.Value.(*tinyLFUEntry).segment].Remove(el).(*tinyLFUEntry)
+	e.segment = to
+	c.items[e.key] = c.segments[to].PushFront(e)
+}
+
+func (c *tinyLFUCache) Get(key int) (int, bool) {
+	c.sketch.increment(key)
+
+	el, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+	c.touch(el)
+	return el.Value.(*tinyLFUEntry).value, true
+}
+
+func (c *tinyLFUCache) touch(el *list.Element) {
+	e := el.Value.(*tinyLFUEntry)
+	if e.segment != probation {
+		c.segments[e.segment].MoveToFront(el)
+		return
+	}
+
+	c.move(el, protected)
+	if c.segments[protected].Len() > c.sizes[protected] {
+		c.move(c.segments[protected].Back(), probation)
+	}
+}
+
+func (c *tinyLFUCache) Set(key, value int) {
+	if el, ok := c.items[key]; ok {
+		c.sketch.increment(key)
+		el.Value.(*tinyLFUEntry).value = value
+		c.touch(el)
+		return
+	}
+	if c.cap <= 0 {
+		return
+	}
+	c.sketch.increment(key)
+
+	c.items[key] = c.segments[window].PushFront(&tinyLFUEntry{key: key, value: value, segment: window})
+	if c.segments[window].Len() <= c.sizes[window] {
+		return
+	}
+
+	candidate := c.segments[window].Back()
+	if c.segments[probation].Len()+c.segments[protected].Len() < c.sizes[probation]+c.sizes[protected] {
+		c.move(candidate, probation)
+		return
+	}
+
+	victim := c.segments[probation].Back()
+	if victim == nil {
+		victim = c.segments[protected].Back()
+	}
+	if victim != nil && c.estimate(candidate) > c.estimate(victim) {
+		c.remove(victim)
+		c.move(candidate, probation)
+	} else {
+		c.remove(candidate)
+	}
+}
+
+func (c *tinyLFUCache) estimate(el *list.Element) uint8 {
+	return c.sketch.estimate(el.Value.(*tinyLFUEntry).key)
+}
+
+func (c *tinyLFUCache) remove(el *list.Element) {
+	e := c.segments[el.Value.(*tinyLFUEntry).segment].Remove(el).(*tinyLFUEntry)
+	delete(c.items, e.key)
+}
+
+func (c *tinyLFUCache) Range(f func(key, value int) bool) {
+	for _, l := range c.segments {
+		for el := l.Back(); el != nil; el = el.Prev() {
+			e := el.Value.(*tinyLFUEntry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *tinyLFUCache) Clear() {
+	clear(c.items)
+	for _, l := range c.segments {
+		l.Init()
+	}
+	c.sketch.clear()
+}
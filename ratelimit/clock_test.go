@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+
+	var fired []time.Duration
+	record := func() { fired = append(fired, clock.Now().Sub(start)) }
+	clock.AfterFunc(2*time.Second, record)
+	clock.AfterFunc(time.Second, record)
+	stopped := clock.AfterFunc(1500*time.Millisecond, record)
+	require.Equal(t, 3, clock.Timers())
+
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+
+	clock.Advance(1999 * time.Millisecond)
+	require.Equal(t, []time.Duration{time.Second}, fired)
+	require.Equal(t, start.Add(1999*time.Millisecond), clock.Now())
+
+	clock.Advance(time.Millisecond)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, fired)
+	require.Zero(t, clock.Timers())
+}
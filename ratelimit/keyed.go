@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepBatch bounds the number of buckets a call checks for idleness,
+// so that dropping many idle keys is spread over the calls.
+const sweepBatch = 16
+
+type keyedBucket[K comparable] struct {
+	key      K
+	bucket   *TokenBucket
+	lastUsed time.Time
+	// refs is the number of calls using the bucket, it is not dropped meanwhile
+	refs int
+	elem *list.Element
+}
+
+// KeyedLimiter keeps a TokenBucket per key, for example per API key or client IP.
+// Buckets are created on the first use of a key and dropped once they are
+// idle for idleTTL and refilled, so memory is bounded by the active keys.
+type KeyedLimiter[K comparable] struct {
+	rate    float64
+	burst   int
+	idleTTL time.Duration
+	opts    []Option
+	clock   Clock
+
+	mu      sync.Mutex
+	buckets map[K]*keyedBucket[K]
+	// recent orders buckets by the last use, the most recent at the front
+	recent *list.List
+	stop   chan struct{}
+}
+
+// NewKeyedLimiter panics if idleTTL is not positive.
+func NewKeyedLimiter[K comparable](rate float64, burst int, idleTTL time.Duration, opts ...Option) *KeyedLimiter[K] {
+	if idleTTL <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive idleTTL %v", idleTTL))
+	}
+
+	o := newOptions(opts)
+	return &KeyedLimiter[K]{
+		rate:    rate,
+		burst:   burst,
+		idleTTL: idleTTL,
+		opts:    opts,
+		clock:   o.clock,
+		buckets: make(map[K]*keyedBucket[K]),
+		recent:  list.New(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Limiter returns the bucket of the key. The bucket is dropped once the key
+// is idle, so it must not be kept: a later call may return a new one.
+func (l *KeyedLimiter[K]) Limiter(key K) *TokenBucket {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.get(key, now).bucket
+}
+
+// get returns the bucket of the key and marks it used, l.mu must be held.
+func (l *KeyedLimiter[K]) get(key K, now time.Time) *keyedBucket[K] {
+	// idle buckets are swept while serving keys
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &keyedBucket[K]{key: key, bucket: NewTokenBucket(l.rate, l.burst, l.opts...)}
+		select {
+		case <-l.stop:
+			b.bucket.Stop()
+		default:
+			b.elem = l.recent.PushFront(b)
+			l.buckets[key] = b
+		}
+	}
+	l.touch(b, now)
+	return b
+}
+
+// touch marks b used at now, l.mu must be held.
+func (l *KeyedLimiter[K]) touch(b *keyedBucket[K], now time.Time) {
+	b.lastUsed = now
+	if b.elem != nil {
+		l.recent.MoveToFront(b.elem)
+	}
+}
+
+// acquire returns the bucket of the key, it is kept until release.
+func (l *KeyedLimiter[K]) acquire(key K) *keyedBucket[K] {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.get(key, now)
+	b.refs++
+	return b
+}
+
+func (l *KeyedLimiter[K]) release(b *keyedBucket[K]) {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b.refs--
+	l.touch(b, now)
+}
+
+// sweep drops up to sweepBatch least recently used buckets, l.mu must be held.
+// Buckets in use or not refilled yet are checked again after idleTTL.
+func (l *KeyedLimiter[K]) sweep(now time.Time) {
+	for range sweepBatch {
+		e := l.recent.Back()
+		if e == nil {
+			return
+		}
+		b := e.Value.(*keyedBucket[K])
+		if now.Sub(b.lastUsed) < l.idleTTL {
+			return
+		}
+		if b.refs == 0 && b.bucket.full(now) {
+			l.recent.Remove(e)
+			delete(l.buckets, b.key)
+		} else {
+			l.touch(b, now)
+		}
+	}
+}
+
+// Len returns the number of keys with a bucket.
+func (l *KeyedLimiter[K]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
+
+func (l *KeyedLimiter[K]) Acquire(ctx context.Context, key K) error {
+	b := l.acquire(key)
+	defer l.release(b)
+	return b.bucket.Acquire(ctx)
+}
+
+func (l *KeyedLimiter[K]) TryAcquire(key K) bool {
+	b := l.acquire(key)
+	defer l.release(b)
+	return b.bucket.TryAcquire()
+}
+
+func (l *KeyedLimiter[K]) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.stop:
+		return
+	default:
+		close(l.stop)
+	}
+	for _, b := range l.buckets {
+		b.bucket.Stop()
+	}
+}
+
+// Middleware limits requests by the key returned by key. Rejected requests get
+// 429 Too Many Requests with Retry-After, every response has X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset, the number of seconds until
+// the bucket is full.
+func (l *KeyedLimiter[K]) Middleware(key func(r *http.Request) K) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, ok, tokens := l.take(key(r))
+			if b.stopped() {
+				http.Error(w, ErrStopped.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			if b.unlimited() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(max(0, int(tokens))))
+			h.Set("X-RateLimit-Reset", seconds((float64(l.burst)-tokens)/l.rate))
+
+			if !ok {
+				h.Set("Retry-After", seconds((1-tokens)/l.rate))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// take takes a token of the key for Middleware,
+// it does nothing if the bucket is stopped or unlimited.
+func (l *KeyedLimiter[K]) take(key K) (b *TokenBucket, ok bool, tokens float64) {
+	kb := l.acquire(key)
+	defer l.release(kb)
+
+	b = kb.bucket
+	if b.stopped() || b.unlimited() {
+		return b, false, 0
+	}
+	ok, tokens = b.tryTake(l.clock.Now())
+	return b, ok, tokens
+}
+
+// seconds formats a duration in seconds, rounded up as clients
+// must not retry earlier.
+func seconds(s float64) string {
+	return strconv.Itoa(int(math.Ceil(s)))
+}
+
+// RemoteIP is a key of Middleware limiting requests per client address.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	limit := NewKeyedLimiter[string](1, 2, time.Minute)
+	defer limit.Stop()
+
+	require.True(t, limit.TryAcquire("a"))
+	require.True(t, limit.TryAcquire("a"))
+	require.False(t, limit.TryAcquire("a"))
+
+	require.True(t, limit.TryAcquire("b"))
+	require.NoError(t, limit.Acquire(context.Background(), "b"))
+	require.Equal(t, 2, limit.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, limit.Acquire(ctx, "b"))
+}
+
+func TestKeyedLimiter_Idle(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewKeyedLimiter[int](1000, 1, 20*time.Millisecond, WithClock(clock))
+	defer limit.Stop()
+
+	for i := 0; i < 100; i++ {
+		require.True(t, limit.TryAcquire(i))
+	}
+	require.Equal(t, 100, limit.Len())
+
+	// every call drops at most sweepBatch buckets
+	clock.Advance(30 * time.Millisecond)
+	require.True(t, limit.TryAcquire(0))
+	require.Equal(t, 101-sweepBatch, limit.Len())
+	for range 100 / sweepBatch {
+		limit.Limiter(0)
+	}
+	require.Equal(t, 1, limit.Len())
+	require.True(t, limit.TryAcquire(100))
+	require.Equal(t, 2, limit.Len())
+}
+
+func TestKeyedLimiter_IdleInUse(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewKeyedLimiter[int](1000, 1, 20*time.Millisecond, WithClock(clock))
+	defer limit.Stop()
+
+	// a full bucket a call still uses is not replaced by a new one
+	b := limit.acquire(0)
+	clock.Advance(30 * time.Millisecond)
+	require.True(t, limit.TryAcquire(1))
+	require.Equal(t, 2, limit.Len())
+	require.Same(t, b.bucket, limit.Limiter(0))
+	limit.release(b)
+
+	clock.Advance(30 * time.Millisecond)
+	require.True(t, limit.TryAcquire(1))
+	require.Equal(t, 1, limit.Len())
+}
+
+func TestKeyedLimiter_InvalidIdleTTL(t *testing.T) {
+	require.Panics(t, func() { NewKeyedLimiter[int](1, 1, 0) })
+}
+
+func TestKeyedLimiter_IdleNotFull(t *testing.T) {
+	// the bucket is refilled in 10s, dropping it earlier would allow a new burst
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewKeyedLimiter[int](1, 10, time.Millisecond, WithClock(clock))
+	defer limit.Stop()
+
+	require.NoError(t, limit.Limiter(0).AcquireN(context.Background(), 10))
+
+	clock.Advance(5 * time.Millisecond)
+	require.False(t, limit.TryAcquire(0))
+	require.Equal(t, 1, limit.Len())
+}
+
+func TestKeyedLimiter_Middleware(t *testing.T) {
+	limit := NewKeyedLimiter[string](0.5, 2, time.Minute)
+	defer limit.Stop()
+
+	handler := limit.Middleware(func(r *http.Request) string {
+		return r.Header.Get("X-Api-Key")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Api-Key", key)
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("a")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Reset"))
+
+	w = do("a")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "4", w.Header().Get("X-RateLimit-Reset"))
+
+	w = do("a")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+	require.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	require.Equal(t, http.StatusNoContent, do("b").Code)
+}
+
+func TestRemoteIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	require.Equal(t, "10.0.0.1", RemoteIP(r))
+
+	r.RemoteAddr = "[::1]:80"
+	require.Equal(t, "::1", RemoteIP(r))
+}
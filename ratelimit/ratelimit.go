@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"time"
@@ -24,19 +25,33 @@ func (mu *Mutex) Unlock() {
 	<-mu.locker
 }
 
+// waiter is a blocked call of Acquire.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// Limiter admits blocked callers in the order of their calls: a free slot
+// goes to the longest waiting caller, newcomers queue behind them.
 type Limiter struct {
 	mu         *Mutex
 	maxCount   int
 	interval   time.Duration
+	clock      Clock
 	stop       chan struct{}
 	timestamps []time.Time
+	waiters    *list.List
+	// timer wakes the waiters when the oldest timestamp leaves the interval
+	timer Timer
 }
 
-func NewLimiter(maxCount int, interval time.Duration) *Limiter {
+func NewLimiter(maxCount int, interval time.Duration, opts ...Option) *Limiter {
+	o := newOptions(opts)
 	if interval == 0 || maxCount == 0 {
 		// без ограничений
 		return &Limiter{
-			stop: make(chan struct{}),
+			clock: o.clock,
+			stop:  make(chan struct{}),
 		}
 	}
 
@@ -44,56 +59,114 @@ func NewLimiter(maxCount int, interval time.Duration) *Limiter {
 		mu:         NewMutex(),
 		maxCount:   maxCount,
 		interval:   interval,
+		clock:      o.clock,
 		stop:       make(chan struct{}),
 		timestamps: make([]time.Time, 0, maxCount),
+		waiters:    list.New(),
 	}
 }
 
 func (l *Limiter) Acquire(ctx context.Context) error {
+	select {
+	case <-l.stop:
+		return ErrStopped
+	default:
+	}
+
 	if l.maxCount == 0 || l.interval == 0 {
-		select {
-		case <-l.stop:
-			return ErrStopped
-		default:
-			return nil
-		}
+		return nil
 	}
 
-	for {
-		now := time.Now()
-		var waitTime time.Duration
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.expire(now)
+	if l.waiters.Len() == 0 && len(l.timestamps) < l.maxCount {
+		l.timestamps = append(l.timestamps, now)
+		l.mu.Unlock()
+		return nil
+	}
 
-		l.mu.Lock()
+	w := &waiter{ready: make(chan struct{})}
+	el := l.waiters.PushBack(w)
+	l.schedule(now)
+	l.mu.Unlock()
 
-		i := 0
-		for i < len(l.timestamps) && now.Sub(l.timestamps[i]) >= l.interval {
-			i++
-		}
-		l.timestamps = l.timestamps[i:]
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-l.stop:
+		err = ErrStopped
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 
-		if len(l.timestamps) < l.maxCount {
-			l.timestamps = append(l.timestamps, now)
-			l.mu.Unlock()
-			return nil
-		}
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-		waitTime = l.interval - now.Sub(l.timestamps[0])
-		l.mu.Unlock()
+	if w.granted {
+		// the slot was given just before the cancellation
+		return nil
+	}
+	l.waiters.Remove(el)
+	return err
+}
 
-		timer := time.NewTimer(waitTime)
-		select {
-		case <-l.stop:
-			timer.Stop()
-			return ErrStopped
-		case <-ctx.Done():
-			timer.Stop()
-			return ctx.Err()
-		case <-timer.C:
-		}
+// expire drops the timestamps which left the interval, l.mu must be held.
+func (l *Limiter) expire(now time.Time) {
+	i := 0
+	for i < len(l.timestamps) && now.Sub(l.timestamps[i]) >= l.interval {
+		i++
+	}
+	l.timestamps = l.timestamps[i:]
+}
+
+// schedule arms the timer for the next free slot, l.mu must be held.
+func (l *Limiter) schedule(now time.Time) {
+	if l.timer != nil || l.waiters.Len() == 0 {
+		return
+	}
+	var delay time.Duration
+	if len(l.timestamps) > 0 {
+		delay = l.timestamps[0].Add(l.interval).Sub(now)
 	}
+	l.timer = l.clock.AfterFunc(delay, l.dispatch)
+}
+
+// dispatch gives free slots to the waiters in the order of arrival.
+func (l *Limiter) dispatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.timer = nil
+	select {
+	case <-l.stop:
+		return
+	default:
+	}
+
+	now := l.clock.Now()
+	l.expire(now)
+	for l.waiters.Len() > 0 && len(l.timestamps) < l.maxCount {
+		w := l.waiters.Remove(l.waiters.Front()).(*waiter)
+		w.granted = true
+		l.timestamps = append(l.timestamps, now)
+		close(w.ready)
+	}
+	l.schedule(now)
 }
 
 func (l *Limiter) Stop() {
+	if l.mu != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if l.timer != nil {
+			l.timer.Stop()
+			l.timer = nil
+		}
+	}
+
 	select {
 	case <-l.stop:
 	default:
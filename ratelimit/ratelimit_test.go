@@ -198,6 +198,119 @@ func TestStressNoBlocking(t *testing.T) {
 	require.NoError(t, eg.Wait())
 }
 
+// waitQueued waits until n callers are blocked in Acquire.
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waiters.Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestFakeClockTiming(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewLimiter(2, time.Second, WithClock(clock))
+	defer limit.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, limit.Acquire(ctx))
+	clock.Advance(500 * time.Millisecond)
+	require.NoError(t, limit.Acquire(ctx))
+
+	done := make(chan error)
+	go func() {
+		done <- limit.Acquire(ctx)
+	}()
+	waitQueued(t, limit, 1)
+
+	clock.Advance(499 * time.Millisecond)
+	waitQueued(t, limit, 1)
+
+	clock.Advance(time.Millisecond)
+	require.NoError(t, <-done)
+}
+
+func TestFairness(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewLimiter(1, time.Second, WithClock(clock))
+	defer limit.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, limit.Acquire(ctx))
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			require.NoError(t, limit.Acquire(ctx))
+			order <- i
+		}()
+		waitQueued(t, limit, i+1)
+	}
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		require.Equal(t, i, <-order)
+
+		// a newcomer does not overtake the waiters, even when called
+		// right after the slot is given away
+		newcomer, cancel := context.WithCancel(ctx)
+		cancel()
+		require.Equal(t, context.Canceled, limit.Acquire(newcomer))
+	}
+}
+
+func TestFairnessCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewLimiter(1, time.Second, WithClock(clock))
+	defer limit.Stop()
+
+	require.NoError(t, limit.Acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		canceled <- limit.Acquire(ctx)
+	}()
+	waitQueued(t, limit, 1)
+
+	done := make(chan error)
+	go func() {
+		done <- limit.Acquire(context.Background())
+	}()
+	waitQueued(t, limit, 2)
+
+	cancel()
+	require.Equal(t, context.Canceled, <-canceled)
+	waitQueued(t, limit, 1)
+
+	clock.Advance(time.Second)
+	require.NoError(t, <-done)
+}
+
+func TestStopWaiters(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	limit := NewLimiter(1, time.Second, WithClock(clock))
+	require.NoError(t, limit.Acquire(context.Background()))
+
+	done := make(chan error)
+	go func() {
+		done <- limit.Acquire(context.Background())
+	}()
+	waitQueued(t, limit, 1)
+
+	limit.Stop()
+	require.Equal(t, ErrStopped, <-done)
+	require.Zero(t, clock.Timers())
+}
+
 func BenchmarkNoBlocking(b *testing.B) {
 	b.ReportAllocs()
 	b.SetBytes(1)
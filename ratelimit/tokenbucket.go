@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExceedsBurst  = errors.New("requested tokens exceed burst")
+	ErrInvalidTokens = errors.New("number of tokens is not positive")
+)
+
+// TokenBucket allows on average rate calls per second and up to burst calls
+// at once. Unlike Limiter it keeps a fixed state whatever the limits are.
+//
+// Tokens are reserved in the order of calls: the bucket goes negative
+// for tokens promised to blocked callers, so newcomers wait behind them.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	clock  Clock
+	stop   chan struct{}
+}
+
+// NewTokenBucket returns a full bucket. Zero rate means no limit.
+func NewTokenBucket(rate float64, burst int, opts ...Option) *TokenBucket {
+	o := newOptions(opts)
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   o.clock.Now(),
+		clock:  o.clock,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (b *TokenBucket) unlimited() bool {
+	return b.rate <= 0
+}
+
+func (b *TokenBucket) stopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// advance adds the tokens accumulated since the last call, b.mu must be held.
+func (b *TokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.burst), b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Reserve takes n tokens and returns how long the caller has to wait
+// before using them.
+func (b *TokenBucket) Reserve(n int) (time.Duration, error) {
+	if n <= 0 {
+		// negative reservations would fill the bucket past burst
+		return 0, fmt.Errorf("reserve %d tokens: %w", n, ErrInvalidTokens)
+	}
+	if b.stopped() {
+		return 0, ErrStopped
+	}
+	if b.unlimited() {
+		return 0, nil
+	}
+	if n > b.burst {
+		return 0, fmt.Errorf("reserve %d tokens with burst %d: %w", n, b.burst, ErrExceedsBurst)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(b.clock.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), nil
+}
+
+// cancel returns reserved tokens to the bucket.
+func (b *TokenBucket) cancel(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(b.clock.Now())
+	b.tokens = min(float64(b.burst), b.tokens+float64(n))
+}
+
+// TryAcquire takes a token if one is available right now.
+func (b *TokenBucket) TryAcquire() bool {
+	if b.stopped() {
+		return false
+	}
+	if b.unlimited() {
+		return true
+	}
+
+	ok, _ := b.tryTake(b.clock.Now())
+	return ok
+}
+
+// tryTake takes a token if one is available at now and returns
+// the tokens left in the bucket.
+func (b *TokenBucket) tryTake(now time.Time) (bool, float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	if b.tokens < 1 {
+		return false, b.tokens
+	}
+	b.tokens--
+	return true, b.tokens
+}
+
+// full reports whether the bucket is refilled at now, so replacing it
+// with a new bucket changes nothing.
+func (b *TokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	return b.tokens >= float64(b.burst)
+}
+
+func (b *TokenBucket) Acquire(ctx context.Context) error {
+	return b.AcquireN(ctx, 1)
+}
+
+// AcquireN waits for n tokens. If ctx is canceled during the wait,
+// the tokens are returned to the bucket.
+func (b *TokenBucket) AcquireN(ctx context.Context, n int) error {
+	delay, err := b.Reserve(n)
+	if err != nil || delay == 0 {
+		return err
+	}
+
+	ready := make(chan struct{})
+	timer := b.clock.AfterFunc(delay, func() { close(ready) })
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return nil
+	case <-b.stop:
+		return ErrStopped
+	case <-ctx.Done():
+		b.cancel(n)
+		return ctx.Err()
+	}
+}
+
+func (b *TokenBucket) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestTokenBucket_Burst(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	bucket := NewTokenBucket(1, 5)
+	defer bucket.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, bucket.AcquireN(ctx, 3))
+	require.NoError(t, bucket.Acquire(ctx))
+	require.True(t, bucket.TryAcquire())
+	require.False(t, bucket.TryAcquire())
+
+	require.Equal(t, context.DeadlineExceeded, bucket.Acquire(ctx))
+	require.ErrorIs(t, bucket.AcquireN(context.Background(), 6), ErrExceedsBurst)
+}
+
+func TestTokenBucket_InvalidTokens(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(1, 2, WithClock(clock))
+	defer bucket.Stop()
+
+	require.ErrorIs(t, bucket.AcquireN(context.Background(), -3), ErrInvalidTokens)
+	require.ErrorIs(t, bucket.AcquireN(context.Background(), 0), ErrInvalidTokens)
+	_, err := bucket.Reserve(-3)
+	require.ErrorIs(t, err, ErrInvalidTokens)
+
+	// the bucket still holds burst tokens
+	require.True(t, bucket.TryAcquire())
+	require.True(t, bucket.TryAcquire())
+	require.False(t, bucket.TryAcquire())
+}
+
+func TestTokenBucket_Rate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(100, 1, WithClock(clock))
+	defer bucket.Stop()
+
+	require.NoError(t, bucket.Acquire(context.Background()))
+	for i := 0; i < 20; i++ {
+		errs := make(chan error)
+		go func() {
+			errs <- bucket.Acquire(context.Background())
+		}()
+		waitTimers(t, clock, 1)
+
+		// a token is added every 10ms
+		clock.Advance(9 * time.Millisecond)
+		select {
+		case err := <-errs:
+			t.Fatalf("acquired early: %v", err)
+		default:
+		}
+		clock.Advance(time.Millisecond)
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, time.Unix(0, 0).Add(200*time.Millisecond), clock.Now())
+}
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(10, 2, WithClock(clock))
+	defer bucket.Stop()
+
+	delay, err := bucket.Reserve(2)
+	require.NoError(t, err)
+	require.Zero(t, delay)
+
+	delay, err = bucket.Reserve(1)
+	require.NoError(t, err)
+	require.InDelta(t, 100*time.Millisecond, delay, float64(time.Nanosecond))
+
+	// the second reservation waits behind the first one
+	delay, err = bucket.Reserve(2)
+	require.NoError(t, err)
+	require.InDelta(t, 300*time.Millisecond, delay, float64(time.Nanosecond))
+	require.False(t, bucket.TryAcquire())
+
+	// the reserved tokens are due in time
+	clock.Advance(300 * time.Millisecond)
+	delay, err = bucket.Reserve(1)
+	require.NoError(t, err)
+	require.InDelta(t, 100*time.Millisecond, delay, float64(time.Nanosecond))
+}
+
+func TestTokenBucket_Cancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(10, 1, WithClock(clock))
+	defer bucket.Stop()
+
+	require.True(t, bucket.TryAcquire())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- bucket.Acquire(ctx)
+	}()
+	waitTimers(t, clock, 1)
+
+	clock.Advance(50 * time.Millisecond)
+	cancel()
+	require.Equal(t, context.Canceled, <-errs)
+	require.Zero(t, clock.Timers())
+
+	// the canceled token is back, the next one is due in 100ms after the first
+	delay, err := bucket.Reserve(1)
+	require.NoError(t, err)
+	require.InDelta(t, 50*time.Millisecond, delay, float64(time.Nanosecond))
+}
+
+func TestTokenBucket_Stop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(0.01, 1, WithClock(clock))
+	require.NoError(t, bucket.Acquire(context.Background()))
+
+	errs := make(chan error)
+	go func() {
+		errs <- bucket.Acquire(context.Background())
+	}()
+
+	waitTimers(t, clock, 1)
+	bucket.Stop()
+	require.Equal(t, ErrStopped, <-errs)
+	require.Equal(t, ErrStopped, bucket.Acquire(context.Background()))
+	require.False(t, bucket.TryAcquire())
+}
+
+// waitTimers waits until n calls block on timers of the clock.
+func waitTimers(t *testing.T, clock *FakeClock, n int) {
+	require.Eventually(t, func() bool {
+		return clock.Timers() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestTokenBucket_NoLimit(t *testing.T) {
+	bucket := NewTokenBucket(0, 0)
+	defer bucket.Stop()
+
+	for i := 0; i < 100; i++ {
+		require.True(t, bucket.TryAcquire())
+		require.NoError(t, bucket.AcquireN(context.Background(), 10))
+	}
+}